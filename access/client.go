@@ -0,0 +1,179 @@
+// Package access is a client of the JFrog Artifactory and Access REST APIs used to manage access tokens,
+// users, groups and permissions.
+package access
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AccessClient is the interface of the Artifactory APIs. Client implements it for an Artifactory instance.
+type AccessClient interface {
+	// GetVersion returns the version of Artifactory
+	GetVersion(ctx context.Context) (*SystemVersion, error)
+
+	// CreateToken creates an access token
+	CreateToken(ctx context.Context, request CreateTokenRequest) (*CreateTokenResponse, error)
+	// RefreshToken exchanges the refresh token of a refreshable access token for a new access token.
+	// Artifactory revokes the old access token, and the new one has the same lifetime the old one was created with.
+	RefreshToken(ctx context.Context, request RefreshTokenRequest) (*CreateTokenResponse, error)
+	// RevokeToken revokes an access token
+	RevokeToken(ctx context.Context, request RevokeTokenRequest) error
+	// GetToken returns the access token with the ID, nil if it isn't listed anymore
+	GetToken(ctx context.Context, tokenID string) (*TokenInfo, error)
+	// GetOwnToken returns the access token itself, nil if Artifactory rejects it
+	GetOwnToken(ctx context.Context, accessToken string) (*TokenInfo, error)
+	// ListTokens returns the access tokens listed by Artifactory
+	ListTokens(ctx context.Context) ([]TokenInfo, error)
+
+	// GetRootCert returns the Access root certificate, which signs access tokens
+	GetRootCert(ctx context.Context) (*x509.Certificate, error)
+	// GetJWKS returns the keys of the Access JWKS endpoint, nil if Artifactory doesn't provide it
+	GetJWKS(ctx context.Context) (*jose.JSONWebKeySet, error)
+
+	// CreateUser creates a user
+	CreateUser(ctx context.Context, request CreateUserRequest) error
+	// DeleteUser deletes the user. A user which doesn't exist is not an error.
+	DeleteUser(ctx context.Context, username string) error
+	// GroupExists verifies that the group exists
+	GroupExists(ctx context.Context, group string) (bool, error)
+	// ProjectExists verifies that the JFrog project exists
+	ProjectExists(ctx context.Context, projectKey string) (bool, error)
+	// AddProjectMember adds the user to the JFrog project with the project roles
+	AddProjectMember(ctx context.Context, projectKey string, member ProjectMember) error
+
+	// CreatePermissionTarget creates the permission target
+	CreatePermissionTarget(ctx context.Context, target PermissionTarget) error
+	// DeletePermissionTarget deletes the permission target. A permission target which doesn't exist is not an error.
+	DeletePermissionTarget(ctx context.Context, name string) error
+
+	// SendUsage reports the usage of features to Artifactory
+	SendUsage(ctx context.Context, usage Usage) error
+}
+
+// Config configures a Client
+type Config struct {
+	// URL is the URL of Artifactory, e.g. https://example.jfrog.io/artifactory.
+	// Its path prefixes the token API of Artifactory versions before 7.21.1.
+	URL string
+	// AccessToken authenticates the requests
+	AccessToken string
+	// Version is the Artifactory version, as returned by GetVersion. It selects the APIs used by the
+	// requests; when unknown, the requests only use the APIs supported by every version.
+	Version string
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+	// RequestTimeout, if set, bounds each request, including its retries and reading the response
+	RequestTimeout time.Duration
+	// UserAgent is the User-Agent header of the requests
+	UserAgent string
+	// Logger logs the failed requests, nothing is logged when nil
+	Logger hclog.Logger
+	// Observer, if set, is called after every attempt of a request, such as to record metrics
+	Observer func(info RequestInfo)
+	// TracerProvider traces the requests, the global OpenTelemetry tracer provider when nil
+	TracerProvider trace.TracerProvider
+}
+
+// Client is the AccessClient of an Artifactory instance
+type Client struct {
+	config     Config
+	url        *url.URL
+	version    *version.Version
+	httpClient *http.Client
+	logger     hclog.Logger
+	tracer     trace.Tracer
+}
+
+var _ AccessClient = (*Client)(nil)
+
+// NewClient returns the client of the Artifactory instance at the URL of the config
+func NewClient(config Config) (*Client, error) {
+	u, err := parseURLWithDefaultPort(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse artifactory url: %w", err)
+	}
+
+	c := &Client{
+		config:     config,
+		url:        u,
+		httpClient: config.HTTPClient,
+		logger:     config.Logger,
+	}
+
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+
+	if c.logger == nil {
+		c.logger = hclog.NewNullLogger()
+	}
+
+	tracerProvider := config.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	c.tracer = tracerProvider.Tracer(tracerName)
+
+	if len(config.Version) > 0 {
+		c.version, err = version.NewVersion(config.Version)
+		if err != nil {
+			c.logger.Error("could not parse Artifactory system version", "ver", config.Version, "err", err)
+		}
+	}
+
+	return c, nil
+}
+
+// versionAtLeast returns whether the Artifactory version is known and at least the version
+func (c *Client) versionAtLeast(ver string) bool {
+	if c.version == nil {
+		return false
+	}
+
+	return c.version.GreaterThanOrEqual(version.Must(version.NewVersion(ver)))
+}
+
+// useNewAccessAPI returns whether the Artifactory version is 7.21.1 or higher, which moved
+// access tokens to the Access API.
+// REF: https://www.jfrog.com/confluence/display/JFROG/Artifactory+REST+API#ArtifactoryRESTAPI-AccessTokens
+func (c *Client) useNewAccessAPI() bool {
+	return c.versionAtLeast("7.21.1")
+}
+
+// tokensPath returns the path of the token API of the Artifactory version
+func (c *Client) tokensPath() string {
+	if c.useNewAccessAPI() {
+		return "/access/api/v1/tokens"
+	}
+	return c.url.Path + "/api/security/token"
+}
+
+// parseURLWithDefaultPort parses the URL, adding the default port of its scheme if it has none
+func parseURLWithDefaultPort(rawUrl string) (*url.URL, error) {
+	urlParsed, err := url.ParseRequestURI(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if urlParsed.Port() == "" {
+		defaultPort, err := net.LookupPort("tcp", urlParsed.Scheme)
+		if err != nil {
+			return nil, err
+		}
+		urlParsed.Host = fmt.Sprintf("%s:%d", urlParsed.Host, defaultPort)
+	}
+
+	return urlParsed, nil
+}
@@ -0,0 +1,212 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClient returns a client of http://myserver.com/artifactory with the Artifactory version
+func newTestClient(t *testing.T, version string) *Client {
+	client, err := NewClient(Config{
+		URL:         "http://myserver.com/artifactory",
+		AccessToken: "test-access-token",
+		Version:     version,
+		UserAgent:   "test-agent",
+	})
+	assert.NoError(t, err)
+
+	return client
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient(Config{URL: "https://myserver.com/artifactory"})
+	assert.NoError(t, err)
+	assert.Equal(t, "myserver.com:443", client.url.Host)
+
+	_, err = NewClient(Config{URL: "myserver.com"})
+	assert.ErrorContains(t, err, "could not parse artifactory url")
+}
+
+func TestClient_CreateToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var request CreateTokenRequest
+	httpmock.RegisterResponder(http.MethodPost, "http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "Bearer test-access-token", req.Header.Get("Authorization"))
+			assert.Equal(t, "test-agent", req.Header.Get("User-Agent"))
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+			return httpmock.NewStringResponse(200, `{"token_id": "new-token-id", "access_token": "new-token"}`), nil
+		})
+
+	httpmock.RegisterResponder(http.MethodPost, "http://myserver.com:80/artifactory/api/security/token",
+		httpmock.NewStringResponder(200, `{"access_token": "legacy-token"}`))
+
+	resp, err := newTestClient(t, "7.55.6").CreateToken(context.Background(), CreateTokenRequest{
+		Username:       "test-username",
+		Scope:          "applied-permissions/user",
+		ExpiresIn:      600,
+		ForceRevocable: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "new-token-id", resp.TokenID)
+	assert.Equal(t, "new-token", resp.AccessToken)
+	assert.Equal(t, "test-username", request.Username)
+	assert.EqualValues(t, 600, request.ExpiresIn)
+	assert.True(t, request.ForceRevocable)
+
+	// Artifactory versions before 7.21.1 use the legacy token API, under the path of the URL
+	resp, err = newTestClient(t, "7.19.10").CreateToken(context.Background(), CreateTokenRequest{Username: "test-username"})
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-token", resp.AccessToken)
+}
+
+func TestClient_APIError(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(403, `{"code": "FORBIDDEN", "detail": "not an admin"}`))
+
+	httpmock.RegisterResponder(http.MethodDelete, "http://myserver.com:80/access/api/v1/tokens/invalid",
+		httpmock.NewStringResponder(400, ""))
+
+	httpmock.RegisterResponder(http.MethodDelete, "http://myserver.com:80/access/api/v1/tokens/missing",
+		httpmock.NewStringResponder(404, ""))
+
+	client := newTestClient(t, "7.55.6")
+
+	_, err := client.CreateToken(context.Background(), CreateTokenRequest{Username: "test-username"})
+	assert.EqualError(t, err, "could not create access token: HTTP response: not an admin")
+
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Equal(t, "FORBIDDEN", apiErr.Response.Code)
+
+	err = client.RevokeToken(context.Background(), RevokeTokenRequest{TokenID: "invalid"})
+	assert.EqualError(t, err, "could not revoke tokenID: invalid: HTTP response 400")
+	assert.Equal(t, http.StatusBadRequest, StatusCode(err))
+
+	// An access token which doesn't exist is already revoked
+	assert.NoError(t, client.RevokeToken(context.Background(), RevokeTokenRequest{TokenID: "missing"}))
+
+	// The Access APIs return a list of errors
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(401, `{"errors": [{"code": "UNAUTHORIZED", "message": "Bad credentials"}]}`))
+
+	_, err = client.ListTokens(context.Background())
+	assert.EqualError(t, err, "could not list tokens: HTTP response: Bad credentials")
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(err))
+
+	assert.Equal(t, 0, StatusCode(errors.New("not an API error")))
+}
+
+func TestClient_IncompatibleVersion(t *testing.T) {
+	client := newTestClient(t, "7.11.0")
+
+	_, err := client.ListTokens(context.Background())
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+
+	_, err = client.GetToken(context.Background(), "token-id")
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+
+	_, err = client.GetRootCert(context.Background())
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+
+	// An unknown version doesn't support any of them
+	_, err = newTestClient(t, "").ListTokens(context.Background())
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+}
+
+func TestClient_GetOwnToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v1/tokens/me",
+		func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") != "Bearer valid-token" {
+				return httpmock.NewStringResponse(401, ""), nil
+			}
+			return httpmock.NewStringResponse(200, `{"token_id": "valid-token-id", "subject": "jfac@01h424hvwpytzk1azxh6k807e5/users/admin"}`), nil
+		})
+
+	client := newTestClient(t, "7.55.6")
+
+	info, err := client.GetOwnToken(context.Background(), "valid-token")
+	assert.NoError(t, err)
+	assert.Equal(t, "valid-token-id", info.TokenID)
+
+	info, err = client.GetOwnToken(context.Background(), "test-access-token")
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+func TestClient_GroupExists(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v2/groups/readers",
+		httpmock.NewStringResponder(200, `{"name": "readers"}`))
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/artifactory/api/security/groups/readers",
+		httpmock.NewStringResponder(200, `{"name": "readers"}`))
+	httpmock.RegisterNoResponder(httpmock.NewStringResponder(404, ""))
+
+	exists, err := newTestClient(t, "7.55.6").GroupExists(context.Background(), "readers")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = newTestClient(t, "7.19.10").GroupExists(context.Background(), "readers")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = newTestClient(t, "7.55.6").GroupExists(context.Background(), "raeders")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["GET http://myserver.com:80/access/api/v2/groups/readers"])
+	assert.Equal(t, 1, info["GET http://myserver.com:80/artifactory/api/security/groups/readers"])
+}
+
+func TestClient_CreatePermissionTarget(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var body map[string]interface{}
+	httpmock.RegisterResponder(http.MethodPost, "http://myserver.com:80/artifactory/api/v2/security/permissions/vault-test",
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+			return httpmock.NewStringResponse(201, ""), nil
+		})
+
+	err := newTestClient(t, "7.55.6").CreatePermissionTarget(context.Background(), PermissionTarget{
+		Name: "vault-test",
+		Repo: PermissionTargetRepo{
+			Repositories:    []string{"generic-local"},
+			IncludePatterns: []string{"jobs/**"},
+			Actions: PermissionTargetActions{
+				Users: map[string][]string{"test-username": {"read"}},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"name": "vault-test",
+		"repo": map[string]interface{}{
+			"repositories":     []interface{}{"generic-local"},
+			"include-patterns": []interface{}{"jobs/**"},
+			"actions": map[string]interface{}{
+				"users": map[string]interface{}{"test-username": []interface{}{"read"}},
+			},
+		},
+	}, body)
+}
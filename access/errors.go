@@ -0,0 +1,87 @@
+package access
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrIncompatibleVersion is returned when the Artifactory version doesn't support the request
+var ErrIncompatibleVersion = errors.New("incompatible version")
+
+// ErrorResponse is the body of an Artifactory error response. The Artifactory APIs return a code, message
+// and detail, the Access APIs a list of errors.
+type ErrorResponse struct {
+	Code    string        `json:"code,omitempty"`
+	Message string        `json:"message,omitempty"`
+	Detail  string        `json:"detail,omitempty"`
+	Errors  []ErrorDetail `json:"errors,omitempty"`
+}
+
+// ErrorDetail is an error of an Access error response
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// detail returns the description of the error, empty if the response has none
+func (r ErrorResponse) detail() string {
+	if len(r.Detail) > 0 {
+		return r.Detail
+	}
+
+	var messages []string
+	for _, e := range r.Errors {
+		if len(e.Message) > 0 {
+			messages = append(messages, e.Message)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// APIError is returned when Artifactory responds to a request with an error status code
+type APIError struct {
+	// Message describes the failed request, such as "could not create access token"
+	Message    string
+	StatusCode int
+	// Response is the error response returned by Artifactory, nil if it returned none
+	Response *ErrorResponse
+}
+
+func (e *APIError) Error() string {
+	if e.Response != nil {
+		if detail := e.Response.detail(); len(detail) > 0 {
+			return fmt.Sprintf("%s: HTTP response: %s", e.Message, detail)
+		}
+	}
+	return fmt.Sprintf("%s: HTTP response %v", e.Message, e.StatusCode)
+}
+
+// StatusCode returns the status code of the Artifactory response the error wraps, 0 if it wraps none
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// apiError builds the error for a failed request, with the error response if any
+func (c *Client) apiError(resp *http.Response, message string) error {
+	e := &APIError{
+		Message:    message,
+		StatusCode: resp.StatusCode,
+	}
+
+	var errResp ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		c.logger.Error(message, "statusCode", resp.StatusCode)
+		return e
+	}
+
+	c.logger.Error(message, "statusCode", resp.StatusCode, "body", errResp)
+	e.Response = &errResp
+	return e
+}
@@ -0,0 +1,253 @@
+package access
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+const (
+	// MaxRetries is how many times idempotent requests are retried on 429 and 5xx responses
+	MaxRetries         = 3
+	retryInitialDelay  = 250 * time.Millisecond
+	retryMaxDelay      = 5 * time.Second
+	retryAfterMaxDelay = 30 * time.Second
+)
+
+// RequestInfo describes an attempt of a request to Artifactory, see Config.Observer
+type RequestInfo struct {
+	Method string
+	// Route is the path of the request with placeholders for its parameters, such as /access/api/v1/tokens/{id}
+	Route string
+	// StatusCode is the status code of the response, 0 if Artifactory couldn't be reached
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// expandRoute returns the path of the route with its placeholders replaced by the escaped params, in order
+func expandRoute(route string, params []string) string {
+	if len(params) == 0 {
+		return route
+	}
+
+	var path strings.Builder
+	for {
+		start := strings.IndexByte(route, '{')
+		end := strings.IndexByte(route, '}')
+		if start < 0 || end < start || len(params) == 0 {
+			path.WriteString(route)
+			return path.String()
+		}
+
+		path.WriteString(route[:start])
+		path.WriteString(url.PathEscape(params[0]))
+		route, params = route[end+1:], params[1:]
+	}
+}
+
+// do sends a request to the Artifactory API, replacing any path in the URL with the path of the route.
+// Idempotent requests (GET, PUT, DELETE) are retried with jittered exponential backoff when Artifactory responds
+// 429 or 5xx, or can't be reached, waiting at least as long as its Retry-After header asks. The request is
+// canceled with the context, or once the RequestTimeout of the config elapses, across its attempts. It's traced as
+// a span of the trace of the context, which is propagated to Artifactory.
+func (c *Client) do(ctx context.Context, method, route string, params []string, body []byte, contentType string) (resp *http.Response, err error) {
+	path := expandRoute(route, params)
+
+	u := *c.url
+	u.Path = path // replace any path in the URL with the provided path
+
+	if c.config.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.RequestTimeout)
+		defer func() {
+			if err != nil {
+				cancel()
+				return
+			}
+			// The timeout bounds reading the response too, so it is only released with the body
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		}()
+	}
+
+	ctx, span := c.startSpan(ctx, method, route, u.String())
+	defer func() { endSpan(span, resp, err) }()
+
+	retries := 0
+	if isIdempotent(method) {
+		retries = MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("User-Agent", c.config.UserAgent)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.config.AccessToken))
+		req.Header.Add("Content-Type", contentType)
+		traceContext.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+		if attempt > 0 {
+			span.SetAttributes(semconv.HTTPResendCount(attempt))
+		}
+
+		start := time.Now()
+		resp, err := c.httpClient.Do(req)
+		c.observe(method, route, resp, time.Since(start), err)
+
+		if attempt >= retries || ctx.Err() != nil || (err == nil && !isRetryableStatus(resp.StatusCode)) {
+			if err != nil {
+				c.logger.Error("error making Artifactory request", "method", method, "path", path, "err", err)
+			}
+			return resp, err
+		}
+
+		delay := retryDelay(attempt, resp)
+		if err != nil {
+			c.logger.Debug("retrying Artifactory request", "method", method, "path", path, "delay", delay, "err", err)
+		} else {
+			c.logger.Debug("retrying Artifactory request", "method", method, "path", path, "delay", delay, "statusCode", resp.StatusCode)
+
+			// Drain the body so that the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// cancelOnClose releases the context of a request once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// observe reports the attempt of a request to the observer of the config, if any
+func (c *Client) observe(method, route string, resp *http.Response, duration time.Duration, err error) {
+	if c.config.Observer == nil {
+		return
+	}
+
+	info := RequestInfo{
+		Method:   method,
+		Route:    route,
+		Duration: duration,
+		Err:      err,
+	}
+	if resp != nil {
+		info.StatusCode = resp.StatusCode
+	}
+
+	c.config.Observer(info)
+}
+
+// get will HTTP GET to the Artifactory API.
+func (c *Client) get(ctx context.Context, route string, params ...string) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, route, params, nil, "application/x-www-form-urlencoded")
+}
+
+// postForm will HTTP POST values to the Artifactory API.
+func (c *Client) postForm(ctx context.Context, route string, values url.Values) (*http.Response, error) {
+	return c.do(ctx, http.MethodPost, route, nil, []byte(values.Encode()), "application/x-www-form-urlencoded")
+}
+
+// postJSON will HTTP POST the JSON of v to the Artifactory API.
+func (c *Client) postJSON(ctx context.Context, v interface{}, route string, params ...string) (*http.Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, http.MethodPost, route, params, body, "application/json")
+}
+
+// putJSON will HTTP PUT the JSON of v to the Artifactory API.
+func (c *Client) putJSON(ctx context.Context, v interface{}, route string, params ...string) (*http.Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, http.MethodPut, route, params, body, "application/json")
+}
+
+// delete will HTTP DELETE to the Artifactory API.
+func (c *Client) delete(ctx context.Context, route string, params ...string) (*http.Response, error) {
+	return c.do(ctx, http.MethodDelete, route, params, nil, "application/x-www-form-urlencoded")
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// retryDelay returns how long to wait before retrying: full jitter exponential backoff,
+// unless the response has a longer Retry-After
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	backoff := retryInitialDelay << attempt
+	if backoff > retryMaxDelay {
+		backoff = retryMaxDelay
+	}
+
+	delay := time.Duration(rand.Int63n(int64(backoff) + 1))
+
+	if resp != nil {
+		if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > delay {
+			delay = retryAfter
+		}
+	}
+
+	return delay
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as an HTTP date, capped to retryAfterMaxDelay
+func parseRetryAfter(value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = time.Until(date)
+	}
+
+	if delay < 0 {
+		return 0
+	}
+	if delay > retryAfterMaxDelay {
+		return retryAfterMaxDelay
+	}
+	return delay
+}
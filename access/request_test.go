@@ -0,0 +1,168 @@
+package access
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_RequestRetries(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	client := newTestClient(t, "7.55.6")
+
+	// Idempotent requests are retried until they succeed
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v1/tokens/retried",
+		httpmock.ResponderFromMultipleResponses([]*http.Response{
+			httpmock.NewStringResponse(503, ""),
+			httpmock.NewStringResponse(429, ""),
+			httpmock.NewStringResponse(200, `{"token_id": "retried"}`),
+		}))
+
+	info, err := client.GetToken(context.Background(), "retried")
+	assert.NoError(t, err)
+	assert.Equal(t, "retried", info.TokenID)
+	assert.Equal(t, 3, httpmock.GetCallCountInfo()["GET http://myserver.com:80/access/api/v1/tokens/retried"])
+
+	// ... and give up after the retries
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v1/tokens/failing",
+		httpmock.NewStringResponder(502, ""))
+
+	_, err = client.GetToken(context.Background(), "failing")
+	assert.ErrorContains(t, err, "HTTP response 502")
+	assert.Equal(t, 1+MaxRetries, httpmock.GetCallCountInfo()["GET http://myserver.com:80/access/api/v1/tokens/failing"])
+
+	// Client errors aren't retried
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v1/tokens/forbidden",
+		httpmock.NewStringResponder(403, ""))
+
+	_, err = client.GetToken(context.Background(), "forbidden")
+	assert.Error(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET http://myserver.com:80/access/api/v1/tokens/forbidden"])
+
+	// Token creation isn't idempotent, it's never retried
+	httpmock.RegisterResponder(http.MethodPost, "http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(503, ""))
+
+	_, err = client.CreateToken(context.Background(), CreateTokenRequest{Username: "test-username", Scope: "applied-permissions/user"})
+	assert.Error(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+}
+
+func TestClient_RequestCanceled(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	client := newTestClient(t, "7.55.6")
+
+	resp := httpmock.NewStringResponse(503, "")
+	resp.Header.Set("Retry-After", "30")
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v1/tokens/unavailable",
+		httpmock.ResponderFromResponse(resp))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetToken(ctx, "unavailable")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET http://myserver.com:80/access/api/v1/tokens/unavailable"])
+}
+
+// The request timeout bounds the request across its retries
+func TestClient_RequestTimeout(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	client, err := NewClient(Config{
+		URL:            "http://myserver.com/artifactory",
+		Version:        "7.55.6",
+		RequestTimeout: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	resp := httpmock.NewStringResponse(503, "")
+	resp.Header.Set("Retry-After", "30")
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v1/tokens/unavailable",
+		httpmock.ResponderFromResponse(resp))
+
+	start := time.Now()
+	_, err = client.GetToken(context.Background(), "unavailable")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET http://myserver.com:80/access/api/v1/tokens/unavailable"])
+
+	// The response is still read once the request returns
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v1/tokens/available",
+		httpmock.NewStringResponder(200, `{"token_id": "available"}`))
+
+	info, err := client.GetToken(context.Background(), "available")
+	assert.NoError(t, err)
+	assert.Equal(t, "available", info.TokenID)
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := retryDelay(attempt, nil)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, retryMaxDelay)
+	}
+
+	resp := httpmock.NewStringResponse(429, "")
+	resp.Header.Set("Retry-After", "3")
+	assert.Equal(t, 3*time.Second, retryDelay(0, resp))
+
+	resp.Header.Set("Retry-After", time.Now().Add(10*time.Second).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, 10*time.Second, retryDelay(0, resp), float64(2*time.Second))
+
+	resp.Header.Set("Retry-After", "3600")
+	assert.Equal(t, retryAfterMaxDelay, retryDelay(0, resp))
+
+	resp.Header.Set("Retry-After", "soon")
+	assert.LessOrEqual(t, retryDelay(0, resp), retryInitialDelay)
+}
+
+func TestClient_RequestObserver(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var observed []RequestInfo
+	client, err := NewClient(Config{
+		URL:         "http://myserver.com/artifactory",
+		AccessToken: "test-access-token",
+		Version:     "7.55.6",
+		Observer:    func(info RequestInfo) { observed = append(observed, info) },
+	})
+	assert.NoError(t, err)
+
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v1/tokens/retried",
+		httpmock.ResponderFromMultipleResponses([]*http.Response{
+			httpmock.NewStringResponse(503, ""),
+			httpmock.NewStringResponse(200, `{"token_id": "retried"}`),
+		}))
+
+	_, err = client.GetToken(context.Background(), "retried")
+	assert.NoError(t, err)
+
+	// Every attempt is observed, with the route rather than the path of the token
+	if assert.Len(t, observed, 2) {
+		assert.Equal(t, http.MethodGet, observed[0].Method)
+		assert.Equal(t, "/access/api/v1/tokens/{id}", observed[0].Route)
+		assert.Equal(t, 503, observed[0].StatusCode)
+		assert.Equal(t, 200, observed[1].StatusCode)
+		assert.NoError(t, observed[1].Err)
+	}
+}
+
+func TestExpandRoute(t *testing.T) {
+	assert.Equal(t, "/access/api/v1/tokens", expandRoute("/access/api/v1/tokens", nil))
+	assert.Equal(t, "/access/api/v1/tokens/a%2Fb", expandRoute("/access/api/v1/tokens/{id}", []string{"a/b"}))
+	assert.Equal(t, "/access/api/v1/projects/proj/users/user",
+		expandRoute("/access/api/v1/projects/{projectKey}/users/{username}", []string{"proj", "user"}))
+}
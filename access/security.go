@@ -0,0 +1,130 @@
+package access
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+func (c *Client) CreateUser(ctx context.Context, request CreateUserRequest) error {
+	resp, err := c.postJSON(ctx, request, "/access/api/v2/users")
+	if err != nil {
+		return err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return c.apiError(resp, fmt.Sprintf("could not create user %s", request.Username))
+	}
+
+	return nil
+}
+
+func (c *Client) DeleteUser(ctx context.Context, username string) error {
+	resp, err := c.delete(ctx, "/access/api/v2/users/{username}", username)
+	if err != nil {
+		return err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return c.apiError(resp, fmt.Sprintf("could not delete user %s", username))
+	}
+
+	return nil
+}
+
+// GroupExists uses the Access groups API on Artifactory 7.49.3 and later, the Artifactory security API otherwise
+func (c *Client) GroupExists(ctx context.Context, group string) (bool, error) {
+	route := "/artifactory/api/security/groups/{group}"
+	if c.versionAtLeast("7.49.3") {
+		route = "/access/api/v2/groups/{group}"
+	}
+
+	return c.exists(ctx, fmt.Sprintf("could not get group %s", group), route, group)
+}
+
+func (c *Client) ProjectExists(ctx context.Context, projectKey string) (bool, error) {
+	return c.exists(ctx, fmt.Sprintf("could not get project %s", projectKey), "/access/api/v1/projects/{projectKey}", projectKey)
+}
+
+// exists returns whether the resource at the route exists
+func (c *Client) exists(ctx context.Context, message, route string, params ...string) (bool, error) {
+	resp, err := c.get(ctx, route, params...)
+	if err != nil {
+		return false, err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return false, c.apiError(resp, message)
+	}
+
+	return true, nil
+}
+
+func (c *Client) AddProjectMember(ctx context.Context, projectKey string, member ProjectMember) error {
+	resp, err := c.putJSON(ctx, member, "/access/api/v1/projects/{projectKey}/users/{username}", projectKey, member.Name)
+	if err != nil {
+		return err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return c.apiError(resp, fmt.Sprintf("could not add user %s to project %s", member.Name, projectKey))
+	}
+
+	return nil
+}
+
+func (c *Client) CreatePermissionTarget(ctx context.Context, target PermissionTarget) error {
+	resp, err := c.postJSON(ctx, target, "/artifactory/api/v2/security/permissions/{name}", target.Name)
+	if err != nil {
+		return err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return c.apiError(resp, fmt.Sprintf("could not create permission target %s", target.Name))
+	}
+
+	return nil
+}
+
+func (c *Client) DeletePermissionTarget(ctx context.Context, name string) error {
+	resp, err := c.delete(ctx, "/artifactory/api/v2/security/permissions/{name}", name)
+	if err != nil {
+		return err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return c.apiError(resp, fmt.Sprintf("could not delete permission target %s", name))
+	}
+
+	return nil
+}
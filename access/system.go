@@ -0,0 +1,117 @@
+package access
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+// jwksPath is the path of the Access JWKS endpoint
+const jwksPath = "/access/api/v1/cert/jwks"
+
+func (c *Client) GetVersion(ctx context.Context) (*SystemVersion, error) {
+	resp, err := c.get(ctx, "/artifactory/api/system/version")
+	if err != nil {
+		return nil, err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.apiError(resp, "could not get the system version")
+	}
+
+	var systemVersion SystemVersion
+	if err := json.NewDecoder(resp.Body).Decode(&systemVersion); err != nil {
+		c.logger.Error("could not parse system version response", "response", resp, "err", err)
+		return nil, err
+	}
+
+	return &systemVersion, nil
+}
+
+// GetRootCert requires Artifactory 7.12.0 or later.
+// REF: https://www.jfrog.com/confluence/display/JFROG/Artifactory+REST+API#ArtifactoryRESTAPI-GetRootCertificate
+func (c *Client) GetRootCert(ctx context.Context) (*x509.Certificate, error) {
+	if !c.versionAtLeast("7.12.0") {
+		return nil, ErrIncompatibleVersion
+	}
+
+	resp, err := c.get(ctx, "/access/api/v1/cert/root")
+	if err != nil {
+		return nil, err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.apiError(resp, "could not get the certificate")
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.logger.Error("error reading root cert response body", "err", err)
+		return nil, err
+	}
+
+	// The certificate is base64 encoded DER
+	binCert := make([]byte, len(body))
+	n, err := base64.StdEncoding.Decode(binCert, body)
+	if err != nil {
+		c.logger.Error("error decoding body", "err", err)
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(binCert[0:n])
+	if err != nil {
+		c.logger.Error("error parsing certificate", "err", err)
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+func (c *Client) GetJWKS(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	resp, err := c.get(ctx, jwksPath)
+	if err != nil {
+		return nil, err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("could not parse the JWKS: %w", err)
+	}
+
+	return &jwks, nil
+}
+
+func (c *Client) SendUsage(ctx context.Context, usage Usage) error {
+	resp, err := c.postJSON(ctx, usage, "/artifactory/api/system/usage")
+	if err != nil {
+		return err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return c.apiError(resp, "could not send usage")
+	}
+
+	return nil
+}
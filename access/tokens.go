@@ -0,0 +1,160 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+func (c *Client) CreateToken(ctx context.Context, request CreateTokenRequest) (*CreateTokenResponse, error) {
+	resp, err := c.postJSON(ctx, request, c.tokensPath())
+	if err != nil {
+		return nil, err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.apiError(resp, "could not create access token")
+	}
+
+	var createdToken CreateTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&createdToken); err != nil {
+		c.logger.Error("could not parse response", "response", resp, "err", err)
+		return nil, err
+	}
+
+	return &createdToken, nil
+}
+
+func (c *Client) RefreshToken(ctx context.Context, request RefreshTokenRequest) (*CreateTokenResponse, error) {
+	values := url.Values{}
+	values.Set("grant_type", "refresh_token")
+	values.Set("refresh_token", request.RefreshToken)
+	values.Set("access_token", request.AccessToken)
+
+	resp, err := c.postForm(ctx, c.tokensPath(), values)
+	if err != nil {
+		return nil, err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.apiError(resp, "could not refresh access token")
+	}
+
+	var refreshedToken CreateTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&refreshedToken); err != nil {
+		c.logger.Error("could not parse response", "response", resp, "err", err)
+		return nil, err
+	}
+
+	return &refreshedToken, nil
+}
+
+// RevokeToken revokes the access token. An access token which doesn't exist, such as one already revoked
+// or expired and removed by Artifactory, is not an error.
+func (c *Client) RevokeToken(ctx context.Context, request RevokeTokenRequest) error {
+	var resp *http.Response
+	var err error
+
+	if c.useNewAccessAPI() {
+		resp, err = c.delete(ctx, "/access/api/v1/tokens/{id}", request.TokenID)
+	} else {
+		values := url.Values{}
+		values.Set("token", request.AccessToken)
+
+		resp, err = c.postForm(ctx, c.url.Path+"/api/security/token/revoke", values)
+	}
+	if err != nil {
+		return err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return c.apiError(resp, fmt.Sprintf("could not revoke tokenID: %s", request.TokenID))
+	}
+
+	return nil
+}
+
+func (c *Client) GetToken(ctx context.Context, tokenID string) (*TokenInfo, error) {
+	return c.getTokenInfo(ctx, c, []int{http.StatusNotFound}, "/access/api/v1/tokens/{id}", tokenID)
+}
+
+func (c *Client) GetOwnToken(ctx context.Context, accessToken string) (*TokenInfo, error) {
+	tokenClient := *c
+	tokenClient.config.AccessToken = accessToken
+	return c.getTokenInfo(ctx, &tokenClient, []int{http.StatusUnauthorized, http.StatusForbidden}, "/access/api/v1/tokens/me")
+}
+
+// getTokenInfo gets the token info at the route with the client, nil for the response status codes
+// meaning the token isn't valid
+func (c *Client) getTokenInfo(ctx context.Context, client *Client, invalidStatusCodes []int, route string, params ...string) (*TokenInfo, error) {
+	if !c.useNewAccessAPI() {
+		return nil, ErrIncompatibleVersion
+	}
+
+	resp, err := client.get(ctx, route, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	for _, statusCode := range invalidStatusCodes {
+		if resp.StatusCode == statusCode {
+			return nil, nil
+		}
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, c.apiError(resp, "could not get token")
+	}
+
+	var info TokenInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("could not parse token: %w", err)
+	}
+
+	return &info, nil
+}
+
+func (c *Client) ListTokens(ctx context.Context) ([]TokenInfo, error) {
+	if !c.useNewAccessAPI() {
+		return nil, ErrIncompatibleVersion
+	}
+
+	resp, err := c.get(ctx, "/access/api/v1/tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, c.apiError(resp, "could not list tokens")
+	}
+
+	var list struct {
+		Tokens []TokenInfo `json:"tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("could not parse tokens: %w", err)
+	}
+
+	return list.Tokens, nil
+}
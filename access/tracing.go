@@ -0,0 +1,44 @@
+package access
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the tracer of the client's spans
+const tracerName = "github.com/jfrog/vault-plugin-secrets-artifactory/access"
+
+// traceContext propagates the trace of the requests to Artifactory in their traceparent header
+var traceContext = propagation.TraceContext{}
+
+// startSpan starts the span of a request to Artifactory, named after its route rather than its path
+func (c *Client) startSpan(ctx context.Context, method, route, url string) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, method+" "+route,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.HTTPRoute(route),
+			semconv.URLFull(url),
+		))
+}
+
+// endSpan ends the span of a request to Artifactory with its outcome
+func endSpan(span trace.Span, resp *http.Response, err error) {
+	defer span.End()
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+}
@@ -0,0 +1,59 @@
+package access
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestClient_Tracing(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	exporter := tracetest.NewInMemoryExporter()
+	client, err := NewClient(Config{
+		URL:            "http://myserver.com/artifactory",
+		AccessToken:    "test-access-token",
+		Version:        "7.55.6",
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+	})
+	assert.NoError(t, err)
+
+	var traceparents []string
+	httpmock.RegisterResponder(http.MethodGet, "http://myserver.com:80/access/api/v1/tokens/retried",
+		func(req *http.Request) (*http.Response, error) {
+			traceparents = append(traceparents, req.Header.Get("traceparent"))
+			if len(traceparents) == 1 {
+				return httpmock.NewStringResponse(503, ""), nil
+			}
+			return httpmock.NewStringResponse(404, ""), nil
+		})
+
+	info, err := client.GetToken(context.Background(), "retried")
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+
+	// A single span covers the attempts of the request
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "GET /access/api/v1/tokens/{id}", span.Name)
+		assert.Equal(t, trace.SpanKindClient, span.SpanKind)
+		assert.Contains(t, span.Attributes, semconv.URLFull("http://myserver.com:80/access/api/v1/tokens/retried"))
+		assert.Contains(t, span.Attributes, semconv.HTTPResendCount(1))
+		assert.Contains(t, span.Attributes, semconv.HTTPResponseStatusCode(404))
+		assert.Equal(t, codes.Error, span.Status.Code)
+
+		// Every attempt propagates the trace
+		traceparent := "00-" + span.SpanContext.TraceID().String() + "-" + span.SpanContext.SpanID().String() + "-01"
+		assert.Equal(t, []string{traceparent, traceparent}, traceparents)
+	}
+}
@@ -0,0 +1,105 @@
+package access
+
+// SystemVersion is the version of Artifactory
+type SystemVersion struct {
+	Version  string `json:"version"`
+	Revision string `json:"revision"`
+}
+
+// CreateTokenRequest is a request to create an access token
+type CreateTokenRequest struct {
+	GrantType             string `json:"grant_type,omitempty"`
+	Username              string `json:"username,omitempty"`
+	Scope                 string `json:"scope,omitempty"`
+	ExpiresIn             int64  `json:"expires_in"`
+	Refreshable           bool   `json:"refreshable,omitempty"`
+	Description           string `json:"description,omitempty"`
+	Audience              string `json:"audience,omitempty"`
+	ForceRevocable        bool   `json:"force_revocable,omitempty"`
+	IncludeReferenceToken bool   `json:"include_reference_token,omitempty"`
+	ProjectKey            string `json:"project_key,omitempty"`
+}
+
+// CreateTokenResponse is an access token created, or refreshed, by Artifactory
+type CreateTokenResponse struct {
+	TokenID        string `json:"token_id"`
+	AccessToken    string `json:"access_token"`
+	RefreshToken   string `json:"refresh_token"`
+	ExpiresIn      int    `json:"expires_in"`
+	Scope          string `json:"scope"`
+	TokenType      string `json:"token_type"`
+	ReferenceToken string `json:"reference_token"`
+}
+
+// RefreshTokenRequest is a request to exchange the refresh token of an access token for a new access token
+type RefreshTokenRequest struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// RevokeTokenRequest is a request to revoke an access token. Artifactory 7.21.1 and later revoke it by
+// its ID, earlier versions by the access token itself.
+type RevokeTokenRequest struct {
+	TokenID     string
+	AccessToken string
+}
+
+// TokenInfo is an access token as listed by the Access tokens API
+type TokenInfo struct {
+	TokenID     string `json:"token_id"`
+	Subject     string `json:"subject"`
+	Expiry      int64  `json:"expiry,omitempty"`
+	IssuedAt    int64  `json:"issued_at,omitempty"`
+	Issuer      string `json:"issuer,omitempty"`
+	Description string `json:"description,omitempty"`
+	Refreshable bool   `json:"refreshable,omitempty"`
+}
+
+// CreateUserRequest is a request to create a user with the Access users API
+type CreateUserRequest struct {
+	Username                 string   `json:"username"`
+	Password                 string   `json:"password"`
+	Email                    string   `json:"email"`
+	Groups                   []string `json:"groups,omitempty"`
+	Admin                    bool     `json:"admin"`
+	ProfileUpdatable         bool     `json:"profile_updatable"`
+	InternalPasswordDisabled bool     `json:"internal_password_disabled"`
+	DisableUIAccess          bool     `json:"disable_ui_access"`
+}
+
+// ProjectMember is a user of a JFrog project, with its project roles
+type ProjectMember struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+// PermissionTarget is a permission target of the v2 permissions API
+type PermissionTarget struct {
+	Name string               `json:"name"`
+	Repo PermissionTargetRepo `json:"repo"`
+}
+
+// PermissionTargetRepo grants actions on repositories
+type PermissionTargetRepo struct {
+	Repositories    []string                `json:"repositories"`
+	IncludePatterns []string                `json:"include-patterns,omitempty"`
+	ExcludePatterns []string                `json:"exclude-patterns,omitempty"`
+	Actions         PermissionTargetActions `json:"actions"`
+}
+
+// PermissionTargetActions are the actions granted to users and groups, by name
+type PermissionTargetActions struct {
+	Users  map[string][]string `json:"users,omitempty"`
+	Groups map[string][]string `json:"groups,omitempty"`
+}
+
+// Usage reports the features used by a product
+type Usage struct {
+	ProductID string    `json:"productId"`
+	Features  []Feature `json:"features"`
+}
+
+// Feature is a feature reported in usage
+type Feature struct {
+	FeatureID string `json:"featureId"`
+}
@@ -1,95 +1,59 @@
 package artifactory
 
 import (
-	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net"
-	"net/http"
-	"net/url"
 	"strings"
+	"time"
 
 	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
 	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/vault/sdk/helper/template"
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 const (
 	defaultUserNameTemplate string = `{{ printf "v-%s-%s" (.RoleName | truncate 24) (random 8) }}` // Docs indicate max length is 256
 )
 
-var ErrIncompatibleVersion = errors.New("incompatible version")
-
-type errorResponse struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Detail  string `json:"detail"`
-}
-
-func (b *backend) RevokeToken(config adminConfiguration, secret logical.Secret) error {
-	tokenId := secret.InternalData["token_id"].(string)
-	u, err := url.Parse(config.ArtifactoryURL)
+func (b *backend) RevokeToken(ctx context.Context, config adminConfiguration, secret logical.Secret) error {
+	client, err := b.accessClient(ctx, config)
 	if err != nil {
-		b.Logger().Error("could not parse artifactory url", "url", u, "err", err)
 		return err
 	}
 
-	var resp *http.Response
+	accessToken, _ := secret.InternalData["access_token"].(string)
+	roleName, _ := secret.InternalData["role"].(string)
 
-	if b.useNewAccessAPI() {
-		resp, err = b.performArtifactoryDelete(config, "/access/api/v1/tokens/"+tokenId)
-		if err != nil {
-			b.Logger().Error("error deleting access token", "tokenId", tokenId, "response", resp, "err", err)
-			return err
-		}
-	} else {
-		accessToken := secret.InternalData["access_token"].(string)
-		values := url.Values{}
-		values.Set("token", accessToken)
+	err = client.RevokeToken(ctx, access.RevokeTokenRequest{
+		TokenID:     secret.InternalData["token_id"].(string),
+		AccessToken: accessToken,
+	})
+	b.emitTokenRevocation(roleName, err)
 
-		resp, err = b.performArtifactoryPost(config, u.Path+"/api/security/token/revoke", values)
-		if err != nil {
-			b.Logger().Error("error deleting token", "tokenId", tokenId, "response", resp, "err", err)
-			return err
-		}
-	}
-	//noinspection GoUnhandledErrorResult
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= http.StatusBadRequest {
-		e := fmt.Errorf("could not revoke tokenID: %v - HTTP response %v", tokenId, resp.StatusCode)
-
-		var errResp errorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
-			b.Logger().Error("revokenToken could not parse error response body", "err", err)
-			return e
-		}
-		b.Logger().Error("revokeToken got bad http status code", "statusCode", resp.StatusCode, "body", errResp)
-		return fmt.Errorf("could not revoke tokenID: %v - %s", tokenId, errResp.Detail)
-	}
-
-	return nil
+	return err
 }
 
-type CreateTokenRequest struct {
-	GrantType             string `json:"grant_type,omitempty"`
-	Username              string `json:"username,omitempty"`
-	Scope                 string `json:"scope,omitempty"`
-	ExpiresIn             int64  `json:"expires_in"`
-	Refreshable           bool   `json:"refreshable,omitempty"`
-	Description           string `json:"description,omitempty"`
-	Audience              string `json:"audience,omitempty"`
-	ForceRevocable        bool   `json:"force_revocable,omitempty"`
-	IncludeReferenceToken bool   `json:"include_reference_token,omitempty"`
+// revokeAccessToken revokes an access token which isn't tracked by a Vault lease
+func (b *backend) revokeAccessToken(ctx context.Context, config adminConfiguration, accessToken, tokenID string) error {
+	return b.RevokeToken(ctx, config, logical.Secret{
+		InternalData: map[string]interface{}{
+			"access_token": accessToken,
+			"token_id":     tokenID,
+		},
+	})
 }
 
-func (b *backend) CreateToken(config adminConfiguration, role artifactoryRole) (*createTokenResponse, error) {
-	request := CreateTokenRequest{
+func (b *backend) CreateToken(ctx context.Context, config adminConfiguration, role artifactoryRole) (*access.CreateTokenResponse, error) {
+	request := access.CreateTokenRequest{
 		GrantType:             role.GrantType,
 		Username:              role.Username,
 		Scope:                 role.Scope,
@@ -97,6 +61,7 @@ func (b *backend) CreateToken(config adminConfiguration, role artifactoryRole) (
 		Description:           role.Description,
 		Refreshable:           role.Refreshable,
 		IncludeReferenceToken: role.IncludeReferenceToken,
+		ProjectKey:            role.ProjectKey,
 	}
 
 	if len(request.Username) == 0 {
@@ -109,392 +74,475 @@ func (b *backend) CreateToken(config adminConfiguration, role artifactoryRole) (
 	// but the token is still usable even after it's deleted. See RTFACT-15293.
 	request.ExpiresIn = 0 // never expires
 
-	if config.UseExpiringTokens && b.supportForceRevocable() && role.MaxTTL > 0 {
-		request.ExpiresIn = int64(role.MaxTTL.Seconds())
+	if expiresIn := b.tokenExpiresIn(ctx, config, role); expiresIn > 0 {
+		request.ExpiresIn = int64(expiresIn.Seconds())
 		request.ForceRevocable = true
 	}
 
-	u, err := url.Parse(config.ArtifactoryURL)
+	client, err := b.accessClient(ctx, config)
 	if err != nil {
-		b.Logger().Error("could not parse artifactory url", "url", u, "err", err)
 		return nil, err
 	}
 
-	path := ""
+	start := time.Now()
+	resp, err := client.CreateToken(ctx, request)
+	b.emitCreateTokenLatency(role.name, start, err)
 
-	if b.useNewAccessAPI() {
-		path = "/access/api/v1/tokens"
-	} else {
-		path = u.Path + "/api/security/token"
-	}
+	return resp, err
+}
 
-	jsonReq, err := json.Marshal(request)
+// RefreshToken exchanges the refresh token of a refreshable access token for a new access token.
+// Artifactory revokes the old access token, and the new one has the same lifetime the old one was created with.
+func (b *backend) RefreshToken(ctx context.Context, config adminConfiguration, accessToken, refreshToken string) (*access.CreateTokenResponse, error) {
+	client, err := b.accessClient(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := b.performArtifactoryPostWithJSON(config, path, jsonReq)
+	return client.RefreshToken(ctx, access.RefreshTokenRequest{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	})
+}
+
+// dynamicUserEmailDomain is the domain of the (mandatory) email address of users created for leases
+const dynamicUserEmailDomain = "vault-secrets-artifactory.invalid"
+
+// createUser creates an Artifactory user which is a member of the groups. The user can only authenticate
+// with the access tokens created for it.
+func (b *backend) createUser(ctx context.Context, config adminConfiguration, username string, groups []string) error {
+	password, err := generateUserPassword()
 	if err != nil {
-		b.Logger().Error("error making token request", "response", resp, "err", err)
-		return nil, err
+		return err
 	}
 
-	//noinspection GoUnhandledErrorResult
-	defer resp.Body.Close()
+	client, err := b.accessClient(ctx, config)
+	if err != nil {
+		return err
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		e := fmt.Errorf("could not create access token: HTTP response %v", resp.StatusCode)
+	return client.CreateUser(ctx, access.CreateUserRequest{
+		Username:                 username,
+		Password:                 password,
+		Email:                    username + "@" + dynamicUserEmailDomain,
+		Groups:                   groups,
+		InternalPasswordDisabled: true,
+		DisableUIAccess:          true,
+	})
+}
 
-		var errResp errorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
-			b.Logger().Error("revokenToken could not parse error response body", "err", err)
-			return nil, e
-		}
-		b.Logger().Error("createToken got non-200 status code", "statusCode", resp.StatusCode, "body", errResp)
-		return nil, fmt.Errorf("could not create access token: HTTP response: %s", errResp.Detail)
+// deleteUser deletes the Artifactory user. A user which doesn't exist is not an error.
+func (b *backend) deleteUser(ctx context.Context, config adminConfiguration, username string) error {
+	client, err := b.accessClient(ctx, config)
+	if err != nil {
+		return err
 	}
 
-	var createdToken createTokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&createdToken); err != nil {
-		b.Logger().Error("could not parse response", "response", resp, "err", err)
-		return nil, err
+	return client.DeleteUser(ctx, username)
+}
+
+// addProjectMember adds the user to the JFrog project with the project roles
+func (b *backend) addProjectMember(ctx context.Context, config adminConfiguration, projectKey, username string, roles []string) error {
+	client, err := b.accessClient(ctx, config)
+	if err != nil {
+		return err
 	}
 
-	return &createdToken, nil
+	return client.AddProjectMember(ctx, projectKey, access.ProjectMember{
+		Name:  username,
+		Roles: roles,
+	})
 }
 
-// supportForceRevocable verifies whether or not the Artifactory version is 7.50.3 or higher.
-// The access API changes in v7.50.3 to support force_revocable to allow us to set the expiration for the tokens.
-// REF: https://www.jfrog.com/confluence/display/JFROG/JFrog+Platform+REST+API#JFrogPlatformRESTAPI-CreateToken
-func (b *backend) supportForceRevocable() bool {
-	return b.checkVersion("7.50.3")
+// permissionTargetNameTemplate generates the unique name of the permission target created for a lease
+const permissionTargetNameTemplate = `{{ printf "vault-%s-%s" (.RoleName | truncate 32) (random 8) }}`
+
+// permissionTargetTemplate is the definition of the permission target created for each lease of a role.
+// It is rendered from the role's permission_target template.
+type permissionTargetTemplate struct {
+	Repositories    []string `json:"repositories"`
+	IncludePatterns []string `json:"include_patterns,omitempty"`
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+	Actions         []string `json:"actions"`
+	Groups          []string `json:"groups,omitempty"`
 }
 
-// useNewAccessAPI verifies whether or not the Artifactory version is 7.21.1 or higher.
-// The access API changed in v7.21.1
-// REF: https://www.jfrog.com/confluence/display/JFROG/Artifactory+REST+API#ArtifactoryRESTAPI-AccessTokens
-func (b *backend) useNewAccessAPI() bool {
-	return b.checkVersion("7.21.1")
+// PermissionTargetMetadata defines the metadata that a permission_target template can use
+type PermissionTargetMetadata struct {
+	Username    string
+	RoleName    string
+	DisplayName string
 }
 
-// getVersion will fetch the current Artifactory version and store it in the backend
-func (b *backend) getVersion(config adminConfiguration) (err error) {
-	resp, err := b.performArtifactoryGet(config, "/artifactory/api/system/version")
-	if err != nil {
-		b.Logger().Error("error making system version request", "response", resp, "err", err)
-		return
+var permissionTargetActions = []string{"read", "write", "annotate", "delete", "manage", "managedXrayMeta", "distribute"}
+
+// renderPermissionTarget renders the permission_target template of a role. The JSON is parsed before the
+// strings are rendered, so that the metadata, such as the display name, can't add fields to it.
+func renderPermissionTarget(permissionTarget string, metadata PermissionTargetMetadata) (*permissionTargetTemplate, error) {
+	var target permissionTargetTemplate
+	if err := json.Unmarshal([]byte(permissionTarget), &target); err != nil {
+		return nil, fmt.Errorf("permission_target is not valid JSON: %w", err)
 	}
 
-	defer resp.Body.Close()
+	for _, values := range [][]string{target.Repositories, target.IncludePatterns, target.ExcludePatterns, target.Actions, target.Groups} {
+		for i, value := range values {
+			rendered, err := renderPermissionTargetString(value, metadata)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = rendered
+		}
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		b.Logger().Error("got non-200 status code", "statusCode", resp.StatusCode)
-		return fmt.Errorf("could not get the system version: HTTP response %v", resp.StatusCode)
+	if len(target.Repositories) == 0 {
+		return nil, fmt.Errorf("permission_target must have repositories")
 	}
 
-	var systemVersion systemVersionResponse
-	if err = json.NewDecoder(resp.Body).Decode(&systemVersion); err != nil {
-		b.Logger().Error("could not parse system version response", "response", resp, "err", err)
-		return
+	if len(target.Actions) == 0 {
+		return nil, fmt.Errorf("permission_target must have actions")
 	}
-	b.version = systemVersion.Version
-	return
-}
 
-// checkVersion will return a boolean and error to check compatibility before making an API call
-// -- This was formerly "checkSystemStatus" but that was hard-coded, that method now calls this one
-func (b *backend) checkVersion(ver string) (compatible bool) {
-	v1, err := version.NewVersion(b.version)
-	if err != nil {
-		b.Logger().Error("could not parse Artifactory system version", "ver", b.version, "err", err)
-		return
+	for _, action := range target.Actions {
+		if !strutil.StrListContains(permissionTargetActions, action) {
+			return nil, fmt.Errorf("permission_target action %q is not one of %s", action, strings.Join(permissionTargetActions, ", "))
+		}
 	}
 
-	v2, err := version.NewVersion(ver)
+	return &target, nil
+}
+
+// renderPermissionTargetString renders a string of the permission_target template
+func renderPermissionTargetString(value string, metadata PermissionTargetMetadata) (string, error) {
+	tmpl, err := template.NewTemplate(template.Template(value))
 	if err != nil {
-		b.Logger().Error("could not parse provided version", "ver", ver, "err", err)
-		return
+		return "", fmt.Errorf("permission_target template initialization error: %w", err)
 	}
 
-	if v1.GreaterThanOrEqual(v2) {
-		compatible = true
+	rendered, err := tmpl.Generate(metadata)
+	if err != nil {
+		return "", fmt.Errorf("permission_target template failed to render: %w", err)
 	}
 
-	return
+	return rendered, nil
 }
 
-// parseJWT will parse a JWT token string from Artifactory and return a *jwt.Token, err
-func (b *backend) parseJWT(config adminConfiguration, token string) (jwtToken *jwt.Token, err error) {
-	validate := true
-
-	cert, err := b.getRootCert(config)
-	if err != nil {
-		if errors.Is(err, ErrIncompatibleVersion) {
-			b.Logger().Error("outdated artifactory, unable to retrieve root cert, skipping token validation")
-			validate = false
-		} else {
-			b.Logger().Error("error retrieving root cert", "err", err.Error())
-			return
-		}
+// createPermissionTarget creates a permission target granting the actions of the template to the user
+// and to the groups of the template
+func (b *backend) createPermissionTarget(ctx context.Context, config adminConfiguration, name, username string, target permissionTargetTemplate) error {
+	actions := access.PermissionTargetActions{
+		Users: map[string][]string{username: target.Actions},
 	}
 
-	// Parse Token
-	if validate {
-		jwtToken, err = jwt.Parse(token,
-			func(token *jwt.Token) (interface{}, error) { return cert.PublicKey, nil },
-			jwt.WithValidMethods([]string{"RS256"}))
-		if err != nil {
-			return
-		}
-		if !jwtToken.Valid {
-			return
-		}
-	} else { // SKIP Validation
-		// -- NOTE THIS IGNORES THE SIGNATURE, which is probably bad,
-		//    but it is artifactory's job to validate the token, right?
-		// p := jwt.Parser{}
-		// token, _, err := p.ParseUnverified(oldAccessToken, jwt.MapClaims{})
-		jwtToken, err = jwt.Parse(token, nil, jwt.WithoutClaimsValidation())
-		if err != nil {
-			return
+	if len(target.Groups) > 0 {
+		actions.Groups = map[string][]string{}
+		for _, group := range target.Groups {
+			actions.Groups[group] = target.Actions
 		}
 	}
 
-	// If we got here, we should have a jwtToken and nil err
-	return
-}
+	client, err := b.accessClient(ctx, config)
+	if err != nil {
+		return err
+	}
 
-type TokenInfo struct {
-	TokenID  string `json:"token_id"`
-	Scope    string `json:"scope"`
-	Username string `json:"username"`
-	Expires  int64  `json:"expires"`
+	return client.CreatePermissionTarget(ctx, access.PermissionTarget{
+		Name: name,
+		Repo: access.PermissionTargetRepo{
+			Repositories:    target.Repositories,
+			IncludePatterns: target.IncludePatterns,
+			ExcludePatterns: target.ExcludePatterns,
+			Actions:         actions,
+		},
+	})
 }
 
-// getTokenInfo will parse the provided token to return useful information about it
-func (b *backend) getTokenInfo(config adminConfiguration, token string) (info *TokenInfo, err error) {
-	// Parse Current Token (to get tokenID/scope)
-	jwtToken, err := b.parseJWT(config, token)
+// deletePermissionTarget deletes the permission target. A permission target which doesn't exist is not an error.
+func (b *backend) deletePermissionTarget(ctx context.Context, config adminConfiguration, name string) error {
+	client, err := b.accessClient(ctx, config)
 	if err != nil {
-		return
+		return err
 	}
 
-	claims, ok := jwtToken.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("error parsing claims in AccessToken")
+	return client.DeletePermissionTarget(ctx, name)
+}
+
+// projectExists verifies that the JFrog project exists
+func (b *backend) projectExists(ctx context.Context, config adminConfiguration, projectKey string) (bool, error) {
+	client, err := b.accessClient(ctx, config)
+	if err != nil {
+		return false, err
 	}
 
-	sub := strings.Split(claims["sub"].(string), "/") // sub -> subject (jfac@01fr1x1h805xmg0t17xhqr1v7a/users/admin)
+	return client.ProjectExists(ctx, projectKey)
+}
 
-	info = &TokenInfo{
-		TokenID:  claims["jti"].(string),     // jti -> JFrog Token ID
-		Scope:    claims["scp"].(string),     // scp -> scope
-		Username: strings.Join(sub[2:], "/"), // 3rd+ elements (incase username has / in it)
+// groupExists verifies that the group exists
+func (b *backend) groupExists(ctx context.Context, config adminConfiguration, group string) (bool, error) {
+	client, err := b.accessClient(ctx, config)
+	if err != nil {
+		return false, err
 	}
 
-	// exp -> expires at (unixtime) - may not be present
-	switch exp := claims["exp"].(type) {
-	case int64:
-		info.Expires = exp
-	case float64:
-		info.Expires = int64(exp) // close enough this should be int64 anyhow
-	case json.Number:
-		v, err := exp.Int64()
-		if err != nil {
-			b.Logger().Error("error parsing token exp as json.Number", "err", err)
-		}
-		info.Expires = v
+	return client.GroupExists(ctx, group)
+}
+
+// getTokenByID returns the access token as listed by Artifactory, nil if it isn't listed anymore
+func (b *backend) getTokenByID(ctx context.Context, config adminConfiguration, tokenID string) (*access.TokenInfo, error) {
+	client, err := b.accessClient(ctx, config)
+	if err != nil {
+		return nil, err
 	}
 
-	return
+	return client.GetToken(ctx, tokenID)
 }
 
-// getRootCert will return the Artifactory access root certificate's public key, for validating token signatures
-func (b *backend) getRootCert(config adminConfiguration) (cert *x509.Certificate, err error) {
-	// Verify Artifactory version is at 7.12.0 or higher, prior versions will not work
-	// REF: https://www.jfrog.com/confluence/display/JFROG/Artifactory+REST+API#ArtifactoryRESTAPI-GetRootCertificate
-	if !b.checkVersion("7.12.0") {
-		return cert, ErrIncompatibleVersion
+// listTokens returns the access tokens listed by Artifactory
+func (b *backend) listTokens(ctx context.Context, config adminConfiguration) ([]access.TokenInfo, error) {
+	client, err := b.accessClient(ctx, config)
+	if err != nil {
+		return nil, err
 	}
 
-	resp, err := b.performArtifactoryGet(config, "/access/api/v1/cert/root")
+	return client.ListTokens(ctx)
+}
+
+// getOwnTokenInfo returns the access token used to authenticate, nil if Artifactory rejects it
+func (b *backend) getOwnTokenInfo(ctx context.Context, config adminConfiguration, token string) (*access.TokenInfo, error) {
+	client, err := b.accessClient(ctx, config)
 	if err != nil {
-		b.Logger().Error("error requesting cert/root", "response", resp, "err", err)
-		return
+		return nil, err
 	}
 
-	defer resp.Body.Close()
+	return client.GetOwnToken(ctx, token)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		b.Logger().Error("got non-200 status code", "statusCode", resp.StatusCode)
-		return cert, fmt.Errorf("could not get the certificate: HTTP response %v", resp.StatusCode)
-	}
+// projectRolesScope returns the scope of a token with the roles in the JFrog project
+func projectRolesScope(projectKey string, roles []string) string {
+	return fmt.Sprintf("applied-permissions/roles:%s:%s", projectKey, strings.Join(roles, ","))
+}
 
-	body, err := io.ReadAll(resp.Body)
-	// body, err := ioutil.ReadAll(resp.Body)  Go.1.15 and earlier
-	if err != nil {
-		b.Logger().Error("error reading root cert response body", "err", err)
-		return
+// generateUserPassword returns a random password meeting the default Artifactory password policy.
+// The internal password of created users is disabled, so it is never used.
+func generateUserPassword() (string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
 	}
 
-	// The certificate is base64 encoded DER
-	binCert := make([]byte, len(body))
-	n, err := base64.StdEncoding.Decode(binCert, body)
+	return base64.RawURLEncoding.EncodeToString(random) + "!Aa1", nil
+}
+
+// supportAccessUsersAPI verifies whether or not the Artifactory version is 7.49.3 or higher,
+// which introduced the Access users API used to create users.
+// REF: https://jfrog.com/help/r/jfrog-rest-apis/create-user
+func (b *backend) supportAccessUsersAPI(ctx context.Context, config adminConfiguration) bool {
+	return b.checkVersion(ctx, config, "7.49.3")
+}
+
+// supportForceRevocable verifies whether or not the Artifactory version is 7.50.3 or higher.
+// The access API changes in v7.50.3 to support force_revocable to allow us to set the expiration for the tokens.
+// REF: https://www.jfrog.com/confluence/display/JFROG/JFrog+Platform+REST+API#JFrogPlatformRESTAPI-CreateToken
+func (b *backend) supportForceRevocable(ctx context.Context, config adminConfiguration) bool {
+	return b.checkVersion(ctx, config, "7.50.3")
+}
+
+// usesExpiringTokens returns whether tokens created on the connection get an expiry in Artifactory
+func (b *backend) usesExpiringTokens(ctx context.Context, config adminConfiguration) bool {
+	return config.UseExpiringTokens && b.supportForceRevocable(ctx, config)
+}
+
+// useNewAccessAPI verifies whether or not the Artifactory version is 7.21.1 or higher.
+// The access API changed in v7.21.1
+// REF: https://www.jfrog.com/confluence/display/JFROG/Artifactory+REST+API#ArtifactoryRESTAPI-AccessTokens
+func (b *backend) useNewAccessAPI(ctx context.Context, config adminConfiguration) bool {
+	return b.checkVersion(ctx, config, "7.21.1")
+}
+
+// getVersion will fetch the current Artifactory version and store it in the backend for the connection
+func (b *backend) getVersion(ctx context.Context, config adminConfiguration) error {
+	client, err := b.accessClientForVersion(config, "")
 	if err != nil {
-		b.Logger().Error("error decoding body", "err", err)
-		return
+		return err
 	}
 
-	cert, err = x509.ParseCertificate(binCert[0:n])
+	systemVersion, err := client.GetVersion(ctx)
 	if err != nil {
-		b.Logger().Error("error parsing certificate", "err", err)
-		return
+		return err
 	}
-	return
-}
 
-type Feature struct {
-	FeatureId string `json:"featureId"`
+	b.connectionsMutex.Lock()
+	defer b.connectionsMutex.Unlock()
+	b.connectionStateLocked(config.name).version = systemVersion.Version
+	return nil
 }
 
-type Usage struct {
-	ProductId string    `json:"productId"`
-	Features  []Feature `json:"features"`
-}
+// connectionVersion returns the detected Artifactory version of the connection, detecting it if
+// it is not yet known (e.g. after the connection was invalidated)
+func (b *backend) connectionVersion(ctx context.Context, config adminConfiguration) string {
+	if version := b.cachedVersion(config.name); version != "" {
+		return version
+	}
 
-func (b *backend) sendUsage(config adminConfiguration, featureId string) {
-	features := []Feature{
-		{
-			FeatureId: featureId,
-		},
+	if err := b.getVersion(ctx, config); err != nil {
+		return ""
 	}
 
-	usage := Usage{
-		productId,
-		features,
+	return b.cachedVersion(config.name)
+}
+
+// cachedVersion returns the Artifactory version detected for the named connection, empty if not yet known
+func (b *backend) cachedVersion(name string) string {
+	b.connectionsMutex.RLock()
+	defer b.connectionsMutex.RUnlock()
+	if state, ok := b.connections[name]; ok {
+		return state.version
 	}
+	return ""
+}
 
-	jsonReq, err := json.Marshal(usage)
+// checkVersion will return a boolean and error to check compatibility before making an API call
+// -- This was formerly "checkSystemStatus" but that was hard-coded, that method now calls this one
+func (b *backend) checkVersion(ctx context.Context, config adminConfiguration, ver string) (compatible bool) {
+	currentVersion := b.connectionVersion(ctx, config)
+	v1, err := version.NewVersion(currentVersion)
 	if err != nil {
-		b.Logger().Info("error marshalling call home request", "err", err)
+		b.Logger().Error("could not parse Artifactory system version", "ver", currentVersion, "err", err)
 		return
 	}
 
-	resp, err := b.performArtifactoryPostWithJSON(config, "artifactory/api/system/usage", jsonReq)
+	v2, err := version.NewVersion(ver)
 	if err != nil {
-		b.Logger().Info("error making call home request", "response", resp, "err", err)
+		b.Logger().Error("could not parse provided version", "ver", ver, "err", err)
 		return
 	}
 
-	//noinspection GoUnhandledErrorResult
-	defer resp.Body.Close()
+	if v1.GreaterThanOrEqual(v2) {
+		compatible = true
+	}
+
+	return
 }
 
-func (b *backend) performArtifactoryGet(config adminConfiguration, path string) (*http.Response, error) {
-	u, err := parseURLWithDefaultPort(config.ArtifactoryURL)
-	if err != nil {
-		return nil, err
+// parseJWT will parse a JWT token string from Artifactory and return a *jwt.Token, err
+func (b *backend) parseJWT(ctx context.Context, config adminConfiguration, token string) (jwtToken *jwt.Token, err error) {
+	jwtToken, err = b.verifyJWT(ctx, config, token)
+	if !errors.Is(err, access.ErrIncompatibleVersion) {
+		return
 	}
 
-	u.Path = path // replace any path in the URL with the provided path
-
-	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	// SKIP Validation
+	b.Logger().Error("outdated artifactory, unable to retrieve root cert, skipping token validation")
+	// -- NOTE THIS IGNORES THE SIGNATURE, which is probably bad,
+	//    but it is artifactory's job to validate the token, right?
+	// p := jwt.Parser{}
+	// token, _, err := p.ParseUnverified(oldAccessToken, jwt.MapClaims{})
+	jwtToken, err = jwt.Parse(token, nil, jwt.WithoutClaimsValidation())
 	if err != nil {
-		return nil, err
+		return
 	}
 
-	req.Header.Set("User-Agent", productId)
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", config.AccessToken))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	// If we got here, we should have a jwtToken and nil err
+	return
+}
 
-	return b.httpClient.Do(req)
+type TokenInfo struct {
+	TokenID  string `json:"token_id"`
+	Scope    string `json:"scope"`
+	Username string `json:"username"`
+	Expires  int64  `json:"expires"`
 }
 
-// performArtifactoryPost will HTTP POST values to the Artifactory API.
-func (b *backend) performArtifactoryPost(config adminConfiguration, path string, values url.Values) (*http.Response, error) {
-	u, err := parseURLWithDefaultPort(config.ArtifactoryURL)
+// getTokenInfo will parse the provided token to return useful information about it
+func (b *backend) getTokenInfo(ctx context.Context, config adminConfiguration, token string) (info *TokenInfo, err error) {
+	// Parse Current Token (to get tokenID/scope)
+	jwtToken, err := b.parseJWT(ctx, config, token)
 	if err != nil {
-		return nil, err
+		return
 	}
 
-	// Replace URL Path
-	u.Path = path
+	claims, ok := jwtToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("error parsing claims in AccessToken")
+	}
 
-	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(values.Encode()))
-	if err != nil {
-		return nil, err
+	sub := strings.Split(claims["sub"].(string), "/") // sub -> subject (jfac@01fr1x1h805xmg0t17xhqr1v7a/users/admin)
+
+	info = &TokenInfo{
+		TokenID:  claims["jti"].(string),     // jti -> JFrog Token ID
+		Scope:    claims["scp"].(string),     // scp -> scope
+		Username: strings.Join(sub[2:], "/"), // 3rd+ elements (incase username has / in it)
 	}
 
-	req.Header.Set("User-Agent", productId)
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", config.AccessToken))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	info.Expires = b.tokenExpiration(claims)
 
-	return b.httpClient.Do(req)
+	return
 }
 
-// performArtifactoryPost will HTTP POST data to the Artifactory API.
-func (b *backend) performArtifactoryPostWithJSON(config adminConfiguration, path string, postData []byte) (*http.Response, error) {
-	u, err := parseURLWithDefaultPort(config.ArtifactoryURL)
-	if err != nil {
-		return nil, err
+// tokenExpiration returns the exp claim (unixtime) of the token claims, or 0 if not present
+func (b *backend) tokenExpiration(claims jwt.MapClaims) (expires int64) {
+	// exp -> expires at (unixtime) - may not be present
+	switch exp := claims["exp"].(type) {
+	case int64:
+		expires = exp
+	case float64:
+		expires = int64(exp) // close enough this should be int64 anyhow
+	case json.Number:
+		v, err := exp.Int64()
+		if err != nil {
+			b.Logger().Error("error parsing token exp as json.Number", "err", err)
+		}
+		expires = v
 	}
 
-	// Replace URL Path
-	u.Path = path
+	return
+}
 
-	postDataBuf := bytes.NewBuffer(postData)
-	req, err := http.NewRequest(http.MethodPost, u.String(), postDataBuf)
+// getRootCert will return the Artifactory access root certificate's public key, for validating token signatures
+func (b *backend) getRootCert(ctx context.Context, config adminConfiguration) (*x509.Certificate, error) {
+	client, err := b.accessClient(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", productId)
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", config.AccessToken))
-	req.Header.Add("Content-Type", "application/json")
-
-	return b.httpClient.Do(req)
+	return client.GetRootCert(ctx)
 }
 
-// performArtifactoryDelete will HTTP DELETE to the Artifactory API.
-// The path will be appended to the configured configured URL Path (usually /artifactory)
-func (b *backend) performArtifactoryDelete(config adminConfiguration, path string) (*http.Response, error) {
-
-	u, err := parseURLWithDefaultPort(config.ArtifactoryURL)
+func (b *backend) sendUsage(config adminConfiguration, featureId string) {
+	httpClient, err := b.getHttpClient(config)
 	if err != nil {
-		return nil, err
+		b.Logger().Info("error making call home request", "err", err)
+		return
 	}
 
-	// Replace URL Path
-	u.Path = path
-
-	req, err := http.NewRequest(http.MethodDelete, u.String(), nil)
-
+	// Usage is sent in the background, outside of any Vault request, so the request isn't counted in the
+	// metrics of the requests to Artifactory nor traced, and the API is the same for every version
+	client, err := b.newAccessClient(access.Config{
+		URL:            config.ArtifactoryURL,
+		AccessToken:    config.AccessToken,
+		HTTPClient:     httpClient,
+		RequestTimeout: config.requestTimeout(),
+		UserAgent:      productId,
+		Logger:         b.Logger(),
+		TracerProvider: noop.NewTracerProvider(),
+	})
 	if err != nil {
-		return nil, err
+		b.Logger().Info("error making call home request", "err", err)
+		return
 	}
 
-	req.Header.Set("User-Agent", productId)
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", config.AccessToken))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	return b.httpClient.Do(req)
-}
-
-func parseURLWithDefaultPort(rawUrl string) (*url.URL, error) {
-	urlParsed, err := url.ParseRequestURI(rawUrl)
-	if err != nil {
-		return nil, err
+	usage := access.Usage{
+		ProductID: productId,
+		Features: []access.Feature{
+			{
+				FeatureID: featureId,
+			},
+		},
 	}
 
-	if urlParsed.Port() == "" {
-		defaultPort, err := net.LookupPort("tcp", urlParsed.Scheme)
-		if err != nil {
-			return nil, err
-		}
-		urlParsed.Host = fmt.Sprintf("%s:%d", urlParsed.Host, defaultPort)
+	// Usage is sent in the background, after the request is done
+	if err := client.SendUsage(context.Background(), usage); err != nil {
+		b.Logger().Info("error making call home request", "err", err)
 	}
-
-	return urlParsed, nil
 }
 
 func testUsernameTemplate(testTemplate string) (up template.StringTemplate, err error) {
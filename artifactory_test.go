@@ -2,12 +2,21 @@ package artifactory
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
 	"net/http"
 	"testing"
 	"time"
 
+	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/jarcoal/httpmock"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,7 +42,7 @@ func TestBackend_CreateTokenSuccess(t *testing.T) {
 	roleData := map[string]interface{}{
 		"role":        "test-role",
 		"username":    "test-username",
-		"scope":       "test-scope",
+		"scope":       "applied-permissions/groups:test-group",
 		"default_ttl": 5 * time.Minute,
 		"max_ttl":     10 * time.Minute,
 	}
@@ -87,7 +96,7 @@ func TestBackend_CreateTokenArtifactoryUnavailable(t *testing.T) {
 	roleData := map[string]interface{}{
 		"role":        "test-role",
 		"username":    "test-username",
-		"scope":       "test-scope",
+		"scope":       "applied-permissions/groups:test-group",
 		"default_ttl": 5 * time.Minute,
 	}
 
@@ -119,7 +128,7 @@ func TestBackend_CreateTokenUnauthorized(t *testing.T) {
 
 	mockArtifactoryUsageVersionRequests("")
 
-	errResp := errorResponse{
+	errResp := access.ErrorResponse{
 		Code:    "Boom",
 		Message: "foo",
 		Detail:  "bar",
@@ -138,7 +147,7 @@ func TestBackend_CreateTokenUnauthorized(t *testing.T) {
 	roleData := map[string]interface{}{
 		"role":        "test-role",
 		"username":    "test-username",
-		"scope":       "test-scope",
+		"scope":       "applied-permissions/groups:test-group",
 		"default_ttl": 5 * time.Minute,
 	}
 
@@ -172,7 +181,7 @@ func TestBackend_CreateTokenArtifactoryMisconfigured(t *testing.T) {
 
 	mockArtifactoryUsageVersionRequests("")
 
-	errResp := errorResponse{
+	errResp := access.ErrorResponse{
 		Code:    "Boom",
 		Message: "foo",
 		Detail:  "bar",
@@ -191,7 +200,7 @@ func TestBackend_CreateTokenArtifactoryMisconfigured(t *testing.T) {
 	roleData := map[string]interface{}{
 		"role":        "test-role",
 		"username":    "test-username",
-		"scope":       "test-scope",
+		"scope":       "applied-permissions/groups:test-group",
 		"default_ttl": 5 * time.Minute,
 	}
 
@@ -242,7 +251,7 @@ func TestBackend_RevokeToken(t *testing.T) {
 	roleData := map[string]interface{}{
 		"role":        "test-role",
 		"username":    "test-username",
-		"scope":       "test-scope",
+		"scope":       "applied-permissions/groups:test-group",
 		"default_ttl": 5 * time.Minute,
 		"max_ttl":     10 * time.Minute,
 	}
@@ -277,6 +286,64 @@ func TestBackend_RevokeToken(t *testing.T) {
 	assert.Nil(t, resp)
 }
 
+// fakeAccessClient is an access.AccessClient which panics on the requests it doesn't implement
+type fakeAccessClient struct {
+	access.AccessClient
+	version      string
+	createTokens []access.CreateTokenRequest
+}
+
+func (c *fakeAccessClient) GetVersion(_ context.Context) (*access.SystemVersion, error) {
+	return &access.SystemVersion{Version: c.version}, nil
+}
+
+func (c *fakeAccessClient) SendUsage(_ context.Context, _ access.Usage) error {
+	return nil
+}
+
+func (c *fakeAccessClient) CreateToken(_ context.Context, request access.CreateTokenRequest) (*access.CreateTokenResponse, error) {
+	c.createTokens = append(c.createTokens, request)
+	return &access.CreateTokenResponse{TokenID: "fake-token-id", AccessToken: "fake-token"}, nil
+}
+
+// Test that the backend only talks to Artifactory through the access client
+func TestBackend_AccessClient(t *testing.T) {
+	b, _ := makeBackend(t)
+
+	fake := &fakeAccessClient{version: "7.55.6"}
+	var configs []access.Config
+	b.newAccessClient = func(config access.Config) (access.AccessClient, error) {
+		configs = append(configs, config)
+		return fake, nil
+	}
+
+	config := adminConfiguration{
+		AccessToken:       "test-access-token",
+		ArtifactoryURL:    "http://myserver.com:80/artifactory",
+		UseExpiringTokens: true,
+	}
+
+	resp, err := b.CreateToken(context.Background(), config, artifactoryRole{
+		Username: "test-username",
+		Scope:    "applied-permissions/user",
+		MaxTTL:   10 * time.Minute,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "fake-token-id", resp.TokenID)
+
+	assert.Len(t, fake.createTokens, 1)
+	assert.Equal(t, "test-username", fake.createTokens[0].Username)
+	assert.EqualValues(t, 600, fake.createTokens[0].ExpiresIn)
+	assert.True(t, fake.createTokens[0].ForceRevocable)
+
+	// The version was detected first, then used by the client creating the token
+	assert.Equal(t, "", configs[0].Version)
+	last := configs[len(configs)-1]
+	assert.Equal(t, "7.55.6", last.Version)
+	assert.Equal(t, "test-access-token", last.AccessToken)
+	assert.Equal(t, productId, last.UserAgent)
+}
+
 // Test that the HTTP request sent to Artifactory matches what the docs say, and that
 // handling the response translates into a proper response.
 func TestBackend_RotateAdminToken(t *testing.T) {
@@ -326,3 +393,78 @@ func TestBackend_RotateAdminToken(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, resp)
 }
+
+// testTokenSigner signs JWT access tokens like Artifactory does, with a generated root certificate
+type testTokenSigner struct {
+	key      *rsa.PrivateKey
+	rootCert string // base64 encoded DER, as returned by /access/api/v1/cert/root
+}
+
+func newTestTokenSigner(t *testing.T) *testTokenSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "JFrog Token Issuer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	return &testTokenSigner{
+		key:      key,
+		rootCert: base64.StdEncoding.EncodeToString(der),
+	}
+}
+
+// accessToken returns a signed access token for the token id, username and scope, expiring after expiresIn (0 for no expiry)
+func (s *testTokenSigner) accessToken(t *testing.T, tokenID, username, scope string, expiresIn time.Duration) string {
+	claims := jwt.MapClaims{
+		"sub": "jfac@01h424hvwpytzk1azxh6k807e5/users/" + username,
+		"scp": scope,
+		"aud": "*@*",
+		"iss": "jfac@01h424hvwpytzk1azxh6k807e5",
+		"iat": time.Now().Unix(),
+		"jti": tokenID,
+	}
+	if expiresIn > 0 {
+		claims["exp"] = time.Now().Add(expiresIn).Unix()
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(s.key)
+	assert.NoError(t, err)
+
+	return token
+}
+
+// createTokenResponse returns the JSON body of a create token response for the access token
+func (s *testTokenSigner) createTokenResponse(t *testing.T, tokenID, accessToken string) string {
+	body, err := json.Marshal(access.CreateTokenResponse{
+		TokenID:     tokenID,
+		AccessToken: accessToken,
+		Scope:       "applied-permissions/admin",
+		TokenType:   "Bearer",
+	})
+	assert.NoError(t, err)
+
+	return string(body)
+}
+
+func TestBackend_RenderPermissionTarget(t *testing.T) {
+	target, err := renderPermissionTarget(
+		`{"repositories": ["generic-local"], "include_patterns": ["jobs/{{.DisplayName}}/**"], "actions": ["read"]}`,
+		PermissionTargetMetadata{
+			Username:    "test-username",
+			RoleName:    "test-role",
+			DisplayName: `x/**"], "actions": ["manage"], "groups": ["admins`,
+		})
+	assert.NoError(t, err)
+
+	// The display name stays in the string of its template
+	assert.Equal(t, []string{`jobs/x/**"], "actions": ["manage"], "groups": ["admins/**`}, target.IncludePatterns)
+	assert.Equal(t, []string{"read"}, target.Actions)
+	assert.Empty(t, target.Groups)
+}
@@ -3,14 +3,24 @@ package artifactory
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/template"
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var Version = "v1.0.0"
@@ -18,11 +28,30 @@ var productId = "vault-plugin-secrets-artifactory/" + Version[1:] // don't need
 
 type backend struct {
 	*framework.Backend
+	// The mutexes are locked in the order rolesMutex, configMutex, revocationsMutex, so that queueing a
+	// revocation while holding the role and config locks can't deadlock with the retries of revocations
 	configMutex      sync.RWMutex
 	rolesMutex       sync.RWMutex
-	httpClient       *http.Client
+	connectionsMutex sync.RWMutex
+	revocationsMutex sync.Mutex
+	tidyMutex        sync.Mutex
+	connections      map[string]*connectionState
 	usernameProducer template.StringTemplate
-	version          string
+	tidyStatus       *tidyStatus
+	metrics          metricsSink
+	tracerProvider   trace.TracerProvider
+	// backendUUID identifies the mount, it marks the descriptions of its access tokens
+	backendUUID string
+	// newAccessClient creates the clients of the Artifactory APIs, tests can replace it
+	newAccessClient func(config access.Config) (access.AccessClient, error)
+}
+
+// connectionState holds the runtime state of a configured Artifactory instance.
+// The default connection (config/admin) is stored under the empty name.
+type connectionState struct {
+	httpClient  *http.Client
+	version     string
+	signingKeys *signingKeys
 }
 
 // UsernameMetadata defines the metadata that a user_template can use to dynamically create user account in Artifactory
@@ -49,8 +78,29 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 	return b, nil
 }
 
-func Backend(_ *logical.BackendConfig) (*backend, error) {
-	b := &backend{}
+func Backend(conf *logical.BackendConfig) (*backend, error) {
+	return newBackend(conf)
+}
+
+// backendOption replaces a dependency of the backend as it is created, such as its metrics sink in tests.
+// Dependencies are only set before the backend is live, as its background goroutines read them.
+type backendOption func(b *backend)
+
+func newBackend(conf *logical.BackendConfig, opts ...backendOption) (*backend, error) {
+	b := &backend{
+		connections:     make(map[string]*connectionState),
+		newAccessClient: newAccessClient,
+		metrics:         globalMetrics{},
+		tracerProvider:  otel.GetTracerProvider(),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if conf != nil {
+		b.backendUUID = conf.BackendUUID
+	}
 
 	up, err := testUsernameTemplate(defaultUserNameTemplate)
 	if err != nil {
@@ -63,26 +113,62 @@ func Backend(_ *logical.BackendConfig) (*backend, error) {
 		RunningVersion: Version,
 
 		PathsSpecial: &logical.Paths{
-			SealWrapStorage: []string{"config/admin"},
+			SealWrapStorage: []string{
+				"config/admin",
+				"config/connections/",
+				"static-cred/",
+				pendingRevocationsPrefix,
+			},
 		},
 
 		BackendType:    logical.TypeLogical,
 		InitializeFunc: b.initialize,
 		Invalidate:     b.invalidate,
+		PeriodicFunc:   b.periodicFunc,
+		WALRollback:    b.walRollback,
 	}
 	b.Backend.Secrets = append(b.Backend.Secrets, b.secretAccessToken())
 	b.Backend.Paths = append(b.Backend.Paths,
 		b.pathListRoles(),
 		b.pathRoles(),
 		b.pathTokenCreate(),
+		b.pathUserTokenSelf(),
 		b.pathUserTokenCreate(),
 		b.pathConfig(),
 		b.pathConfigRotate(),
-		b.pathConfigUserToken())
+		b.pathConfigUserToken(),
+		b.pathConfigScopePolicy(),
+		b.pathIntrospect(),
+		b.pathTidy(),
+		b.pathTidyStatus(),
+		b.pathListConnections(),
+		b.pathConfigConnections(),
+		b.pathListStaticRoles(),
+		b.pathStaticRoles(),
+		b.pathStaticCred(),
+		b.pathListPendingRevocations(),
+		b.pathPendingRevocations())
 
 	return b, nil
 }
 
+// HandleRequest handles the request, responding to failed Artifactory requests with the matching status code.
+// The request and its storage operations are traced.
+func (b *backend) HandleRequest(ctx context.Context, req *logical.Request) (*logical.Response, error) {
+	ctx, span := b.startRequestSpan(ctx, req)
+
+	if req.Storage != nil {
+		storage := req.Storage
+		req.Storage = &tracedStorage{Storage: storage, tracer: b.tracer()}
+		defer func() { req.Storage = storage }()
+	}
+
+	resp, err := artifactoryErrorResponse(b.Backend.HandleRequest(ctx, req))
+	endRequestSpan(span, resp, err)
+
+	return resp, err
+}
+
 // initialize will initialize the backend configuration
 func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
 	config, err := b.fetchAdminConfiguration(ctx, req.Storage)
@@ -94,9 +180,12 @@ func (b *backend) initialize(ctx context.Context, req *logical.InitializationReq
 		return nil
 	}
 
-	b.InitializeHttpClient(config)
+	err = b.InitializeHttpClient(config)
+	if err != nil {
+		return err
+	}
 
-	err = b.getVersion(*config)
+	err = b.getVersion(ctx, *config)
 	if err != nil {
 		return err
 	}
@@ -112,42 +201,217 @@ func (b *backend) initialize(ctx context.Context, req *logical.InitializationReq
 	return nil
 }
 
-func (b *backend) InitializeHttpClient(config *adminConfiguration) {
-	if config.BypassArtifactoryTLSVerification {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: config.BypassArtifactoryTLSVerification,
-			},
+// periodicFunc performs the scheduled maintenance of the backend
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	if !b.WriteSafeReplicationState() {
+		return nil
+	}
+
+	return errors.Join(
+		b.periodicRotateAdminToken(ctx, req.Storage),
+		b.periodicRotateStaticRoles(ctx, req.Storage),
+		b.periodicRetryRevocations(ctx, req.Storage),
+		b.reportAdminTokenExpiry(ctx, req.Storage),
+	)
+}
+
+func (b *backend) InitializeHttpClient(config *adminConfiguration) error {
+	httpClient, err := newHttpClient(config)
+	if err != nil {
+		return err
+	}
+
+	b.connectionsMutex.Lock()
+	defer b.connectionsMutex.Unlock()
+	b.connectionStateLocked(config.name).httpClient = httpClient
+	return nil
+}
+
+func newHttpClient(config *adminConfiguration) (*http.Client, error) {
+	client := &http.Client{}
+
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok && !config.BypassArtifactoryTLSVerification && !config.hasCustomTLS() {
+		// http.DefaultTransport was replaced, such as by instrumentation, use it as is
+		client.Transport = http.DefaultTransport
+		return client, nil
+	}
+
+	tr := &http.Transport{}
+	if ok {
+		tr = base.Clone()
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   config.connectTimeout(),
+		KeepAlive: 30 * time.Second,
+	}
+	tr.DialContext = dialer.DialContext
+	tr.TLSHandshakeTimeout = config.connectTimeout()
+
+	if config.BypassArtifactoryTLSVerification || config.hasCustomTLS() {
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = tlsConfig
+	}
+
+	client.Transport = tr
+	return client, nil
+}
+
+// newTLSConfig builds the TLS configuration used to connect to Artifactory from the CA bundle
+// and client certificate of the connection
+func newTLSConfig(config *adminConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.BypassArtifactoryTLSVerification,
+	}
+
+	if len(config.CACert) > 0 || len(config.CAPath) > 0 {
+		pool := x509.NewCertPool()
+
+		if len(config.CACert) > 0 && !pool.AppendCertsFromPEM([]byte(config.CACert)) {
+			return nil, fmt.Errorf("could not parse PEM certificates in ca_cert")
+		}
+
+		if len(config.CAPath) > 0 {
+			err := filepath.WalkDir(config.CAPath, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if d.IsDir() {
+					return nil
+				}
+
+				pem, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+
+				if !pool.AppendCertsFromPEM(pem) {
+					return fmt.Errorf("could not parse PEM certificates in %s", path)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("could not load ca_path: %w", err)
+			}
 		}
 
-		b.httpClient = &http.Client{Transport: tr}
-	} else {
-		b.httpClient = http.DefaultClient
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(config.ClientCert) > 0 || len(config.ClientKey) > 0 {
+		cert, err := tls.X509KeyPair([]byte(config.ClientCert), []byte(config.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse client_cert and client_key: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// connectionStateLocked returns the runtime state for the named connection, creating it if needed.
+// The caller must hold connectionsMutex for writing.
+func (b *backend) connectionStateLocked(name string) *connectionState {
+	state, ok := b.connections[name]
+	if !ok {
+		state = &connectionState{}
+		b.connections[name] = state
+	}
+	return state
+}
+
+// getHttpClient returns the HTTP client for the connection, initializing it if needed
+func (b *backend) getHttpClient(config adminConfiguration) (*http.Client, error) {
+	b.connectionsMutex.RLock()
+	var cached *http.Client
+	if state, ok := b.connections[config.name]; ok {
+		cached = state.httpClient
+	}
+	b.connectionsMutex.RUnlock()
+
+	if cached != nil {
+		return cached, nil
 	}
+
+	httpClient, err := newHttpClient(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	b.connectionsMutex.Lock()
+	defer b.connectionsMutex.Unlock()
+	b.connectionStateLocked(config.name).httpClient = httpClient
+	return httpClient, nil
+}
+
+// newAccessClient creates the client of the Artifactory instance
+func newAccessClient(config access.Config) (access.AccessClient, error) {
+	return access.NewClient(config)
+}
+
+// accessClient returns the client of the connection's Artifactory, for its detected version
+func (b *backend) accessClient(ctx context.Context, config adminConfiguration) (access.AccessClient, error) {
+	return b.accessClientForVersion(config, b.connectionVersion(ctx, config))
+}
+
+// accessClientForVersion returns the client of the connection's Artifactory, using the APIs of the version
+func (b *backend) accessClientForVersion(config adminConfiguration, version string) (access.AccessClient, error) {
+	httpClient, err := b.getHttpClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newAccessClient(access.Config{
+		URL:            config.ArtifactoryURL,
+		AccessToken:    config.AccessToken,
+		Version:        version,
+		HTTPClient:     httpClient,
+		RequestTimeout: config.requestTimeout(),
+		UserAgent:      productId,
+		Logger:         b.Logger(),
+		Observer:       b.observeArtifactoryRequest(config.name),
+		TracerProvider: b.tracerProvider,
+	})
 }
 
 // invalidate clears an existing client configuration in
 // the backend
 func (b *backend) invalidate(ctx context.Context, key string) {
-	if key == "config" {
-		b.reset()
+	switch {
+	case key == "config/admin":
+		b.reset("")
+	case strings.HasPrefix(key, "config/connections/"):
+		b.reset(strings.TrimPrefix(key, "config/connections/"))
 	}
 }
 
-// reset clears any client configuration for a new
-// backend to be configured
-func (b *backend) reset() {
-	b.configMutex.Lock()
-	defer b.configMutex.Unlock()
-	b.httpClient = nil
+// reset clears any client configuration for the named connection so that
+// it is rebuilt from storage the next time it is used
+func (b *backend) reset(name string) {
+	b.connectionsMutex.Lock()
+	defer b.connectionsMutex.Unlock()
+	delete(b.connections, name)
 }
 
 // fetchAdminConfiguration will return nil,nil if there's no configuration
 func (b *backend) fetchAdminConfiguration(ctx context.Context, storage logical.Storage) (*adminConfiguration, error) {
+	return b.fetchConnectionConfiguration(ctx, storage, "")
+}
+
+// fetchConnectionConfiguration will return nil,nil if the named connection is not configured.
+// The empty name refers to the default connection stored at config/admin.
+func (b *backend) fetchConnectionConfiguration(ctx context.Context, storage logical.Storage, name string) (*adminConfiguration, error) {
 	var config adminConfiguration
 
 	// Read in the backend configuration
-	entry, err := storage.Get(ctx, "config/admin")
+	entry, err := storage.Get(ctx, connectionStoragePath(name))
 	if err != nil {
 		return nil, err
 	}
@@ -159,10 +423,27 @@ func (b *backend) fetchAdminConfiguration(ctx context.Context, storage logical.S
 	if err := entry.DecodeJSON(&config); err != nil {
 		return nil, err
 	}
+	config.name = name
 
 	return &config, nil
 }
 
+// notConfiguredResponse returns the error response used when the named connection is not configured
+func notConfiguredResponse(name string) *logical.Response {
+	if name == "" {
+		return logical.ErrorResponse("backend not configured")
+	}
+	return logical.ErrorResponse("connection %q not configured", name)
+}
+
+// connectionStoragePath returns the storage path of the named connection
+func connectionStoragePath(name string) string {
+	if name == "" {
+		return "config/admin"
+	}
+	return "config/connections/" + name
+}
+
 const artifactoryHelp = `
 The Artifactory secrets backend provides Artifactory access tokens based on configured roles.
 `
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 
 	artifactory "github.com/jfrog/vault-plugin-secrets-artifactory"
@@ -24,10 +25,28 @@ func main() {
 	tlsConfig := apiClientMeta.GetTLSConfig()
 	tlsProviderFunc := api.VaultPluginTLSProvider(tlsConfig)
 
-	err := plugin.ServeMultiplex(&plugin.ServeOpts{
+	shutdownTracing, err := artifactory.ConfigureTracing(context.Background())
+	if err != nil {
+		logger.Error("could not configure tracing, traces are not exported", "error", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+
+	shutdownMetrics, err := artifactory.ConfigureMetrics()
+	if err != nil {
+		logger.Error("could not configure metrics, metrics are discarded", "error", err)
+		shutdownMetrics = func() {}
+	}
+
+	err = plugin.ServeMultiplex(&plugin.ServeOpts{
 		BackendFactoryFunc: artifactory.Factory,
 		TLSProviderFunc:    tlsProviderFunc,
 	})
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Error("could not flush traces", "error", err)
+	}
+	shutdownMetrics()
+
 	if err != nil {
 		logger.Error("plugin shutting down", "error", err)
 		os.Exit(1)
@@ -0,0 +1,364 @@
+package artifactory
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	formatDocker     = "docker"
+	formatKubernetes = "kubernetes"
+	formatNpmrc      = "npmrc"
+	formatPip        = "pip"
+	formatMaven      = "maven"
+	formatNetrc      = "netrc"
+	formatGradle     = "gradle"
+)
+
+// CredentialMetadata is what the credential formats are rendered from
+type CredentialMetadata struct {
+	RoleName       string
+	Username       string
+	AccessToken    string
+	ReferenceToken string
+	ArtifactoryURL string
+	Registries     []string
+	Repository     string
+	// Templates overrides the templates of the text formats, by format
+	Templates map[string]string
+}
+
+// credentialRenderer renders credentials in a format, returning the fields added to the response
+type credentialRenderer func(metadata CredentialMetadata) (map[string]interface{}, error)
+
+var credentialRenderers = map[string]credentialRenderer{
+	formatDocker:     renderDockerConfig,
+	formatKubernetes: renderImagePullSecret,
+	formatNpmrc:      textCredentialFormats[formatNpmrc].render,
+	formatPip:        textCredentialFormats[formatPip].render,
+	formatMaven:      textCredentialFormats[formatMaven].render,
+	formatNetrc:      textCredentialFormats[formatNetrc].render,
+	formatGradle:     textCredentialFormats[formatGradle].render,
+}
+
+// credentialFormats returns the names of the supported formats
+func credentialFormats() []string {
+	formats := make([]string, 0, len(credentialRenderers))
+	for format := range credentialRenderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// renderCredentials renders the credentials in the requested format
+func renderCredentials(format string, metadata CredentialMetadata) (map[string]interface{}, error) {
+	renderer, ok := credentialRenderers[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format %q, must be one of %s", format, strings.Join(credentialFormats(), ", "))
+	}
+	return renderer(metadata)
+}
+
+// checkCredentialFormat checks the credentials can be rendered in the format, before issuing them
+func checkCredentialFormat(format string, metadata CredentialMetadata) error {
+	if _, ok := credentialRenderers[format]; !ok {
+		return fmt.Errorf("unsupported format %q, must be one of %s", format, strings.Join(credentialFormats(), ", "))
+	}
+
+	if f, ok := textCredentialFormats[format]; ok {
+		if _, custom := metadata.Templates[format]; !custom && f.needsRepository && len(metadata.Repository) == 0 {
+			return fmt.Errorf("format %q requires a repository", format)
+		}
+	}
+
+	return nil
+}
+
+type dockerAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+// dockerRegistries returns the registry hosts of the credentials, the host of the Artifactory URL by default
+func dockerRegistries(metadata CredentialMetadata) ([]string, error) {
+	if len(metadata.Registries) > 0 {
+		return metadata.Registries, nil
+	}
+
+	u, err := url.Parse(metadata.ArtifactoryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("no registry host in Artifactory URL %q", metadata.ArtifactoryURL)
+	}
+
+	return []string{u.Host}, nil
+}
+
+func dockerConfigJSON(metadata CredentialMetadata) ([]byte, error) {
+	registries, err := dockerRegistries(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	config := dockerConfig{Auths: map[string]dockerAuth{}}
+	for _, registry := range registries {
+		config.Auths[registry] = dockerAuth{
+			Username: metadata.Username,
+			Password: metadata.AccessToken,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(metadata.Username + ":" + metadata.AccessToken)),
+		}
+	}
+
+	return json.Marshal(config)
+}
+
+// renderDockerConfig renders a ~/.docker/config.json
+func renderDockerConfig(metadata CredentialMetadata) (map[string]interface{}, error) {
+	config, err := dockerConfigJSON(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"docker_config": string(config),
+	}, nil
+}
+
+var invalidSecretNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// imagePullSecretName returns a Kubernetes object name for the image pull secret of the role
+func imagePullSecretName(roleName string) string {
+	name := "artifactory-" + invalidSecretNameChars.ReplaceAllString(strings.ToLower(roleName), "-")
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return strings.TrimRight(name, ".-")
+}
+
+// renderImagePullSecret renders a kubernetes.io/dockerconfigjson secret, to be used as imagePullSecret
+func renderImagePullSecret(metadata CredentialMetadata) (map[string]interface{}, error) {
+	config, err := dockerConfigJSON(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "kubernetes.io/dockerconfigjson",
+		"metadata": map[string]interface{}{
+			"name": imagePullSecretName(metadata.RoleName),
+		},
+		"data": map[string]interface{}{
+			".dockerconfigjson": base64.StdEncoding.EncodeToString(config),
+		},
+	}
+
+	manifest, err := json.Marshal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"docker_config":     string(config),
+		"image_pull_secret": string(manifest),
+	}, nil
+}
+
+// validateDockerRegistries checks registries are hosts, with an optional port
+func validateDockerRegistries(registries []string) error {
+	for _, registry := range registries {
+		u, err := url.Parse("//" + registry)
+		if err != nil || len(registry) == 0 || u.Host != registry {
+			return fmt.Errorf("invalid docker registry %q, must be a host with an optional port", registry)
+		}
+	}
+	return nil
+}
+
+// textCredentialFormat is a format rendered from a text template, which can be overridden per role
+type textCredentialFormat struct {
+	format          string
+	field           string
+	template        string
+	needsRepository bool
+}
+
+var textCredentialFormats = map[string]textCredentialFormat{
+	formatNpmrc: {
+		format: formatNpmrc,
+		field:  "npmrc",
+		template: `registry={{.RepositoryURL "npm"}}/
+{{.RepositoryURL "npm" | trimScheme}}/:_authToken={{.Token}}
+{{.RepositoryURL "npm" | trimScheme}}/:always-auth=true
+`,
+		needsRepository: true,
+	},
+	formatPip: {
+		format: formatPip,
+		field:  "pip_conf",
+		template: `[global]
+index-url = {{.AuthenticatedRepositoryURL "pypi"}}/simple
+`,
+		needsRepository: true,
+	},
+	formatMaven: {
+		format: formatMaven,
+		field:  "settings_xml",
+		template: `<settings>
+  <servers>
+    <server>
+      <id>{{xml .Repository}}</id>
+      <username>{{xml .Username}}</username>
+      <password>{{xml .Token}}</password>
+    </server>
+  </servers>
+</settings>
+`,
+		needsRepository: true,
+	},
+	formatNetrc: {
+		format: formatNetrc,
+		field:  "netrc",
+		template: `machine {{.Hostname}}
+login {{.Username}}
+password {{.Token}}
+`,
+	},
+	formatGradle: {
+		format: formatGradle,
+		field:  "gradle_properties",
+		template: `artifactoryUrl={{.ArtifactoryURL}}/artifactory
+artifactoryRepository={{.Repository}}
+artifactoryUser={{.Username}}
+artifactoryPassword={{.Token}}
+`,
+		needsRepository: true,
+	},
+}
+
+// credentialTemplateData is what the templates of the text formats can use
+type credentialTemplateData struct {
+	CredentialMetadata
+	// Token is the reference token if there is one, the access token otherwise
+	Token    string
+	Host     string
+	Hostname string
+	// baseURL is the scheme and host of the Artifactory URL, any path in it is replaced, as for the requests
+	// to Artifactory
+	baseURL *url.URL
+}
+
+// RepositoryURL returns the URL of the repository for the package type API, without a trailing slash
+func (d credentialTemplateData) RepositoryURL(packageType string) string {
+	u := *d.baseURL
+	u.Path = "/artifactory/api/" + packageType + "/" + d.Repository
+	return u.String()
+}
+
+// AuthenticatedRepositoryURL returns the URL of the repository with the credentials
+func (d credentialTemplateData) AuthenticatedRepositoryURL(packageType string) string {
+	u := *d.baseURL
+	u.User = url.UserPassword(d.Username, d.Token)
+	u.Path = "/artifactory/api/" + packageType + "/" + d.Repository
+	return u.String()
+}
+
+var credentialTemplateFuncs = template.FuncMap{
+	"xml": func(s string) (string, error) {
+		var buf bytes.Buffer
+		if err := xml.EscapeText(&buf, []byte(s)); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	},
+	"trimScheme": func(s string) string {
+		if i := strings.Index(s, "://"); i >= 0 {
+			return s[i+1:]
+		}
+		return s
+	},
+}
+
+func (f textCredentialFormat) render(metadata CredentialMetadata) (map[string]interface{}, error) {
+	text, custom := metadata.Templates[f.format]
+	if !custom {
+		text = f.template
+		if f.needsRepository && len(metadata.Repository) == 0 {
+			return nil, fmt.Errorf("format %q requires a repository", f.format)
+		}
+	}
+
+	tmpl, err := template.New(f.format).Funcs(credentialTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", f.format, err)
+	}
+
+	u, err := url.Parse(metadata.ArtifactoryURL)
+	if err != nil {
+		return nil, err
+	}
+	u = &url.URL{Scheme: u.Scheme, Host: u.Host}
+
+	data := credentialTemplateData{
+		CredentialMetadata: metadata,
+		Token:              metadata.AccessToken,
+		Host:               u.Host,
+		Hostname:           u.Hostname(),
+		baseURL:            u,
+	}
+	if len(metadata.ReferenceToken) > 0 {
+		data.Token = metadata.ReferenceToken
+	}
+	data.ArtifactoryURL = u.String()
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error rendering %s template: %w", f.format, err)
+	}
+
+	return map[string]interface{}{
+		f.field: buf.String(),
+	}, nil
+}
+
+// validateCredentialTemplates checks the templates of a role render, for formats which can be templated
+func validateCredentialTemplates(templates map[string]string) error {
+	for format := range templates {
+		f, ok := textCredentialFormats[format]
+		if !ok {
+			return fmt.Errorf("format %q can't be templated", format)
+		}
+
+		_, err := f.render(CredentialMetadata{
+			RoleName:       "test-role",
+			Username:       "test-username",
+			AccessToken:    "test-access-token",
+			ReferenceToken: "test-reference-token",
+			ArtifactoryURL: "https://test.jfrog.io",
+			Repository:     "test-repository",
+			Templates:      templates,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
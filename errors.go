@@ -0,0 +1,66 @@
+package artifactory
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+)
+
+// artifactoryErrorStatus returns the status code of the Vault response for an error of an Artifactory request,
+// 0 if the error isn't one:
+//   - 400 when Artifactory rejects the request, such as an invalid scope
+//   - 401 and 403 when Artifactory rejects the admin token
+//   - 404 when Artifactory doesn't find what the request refers to, such as a user
+//   - 502 when Artifactory fails the request, or its certificate can't be verified
+//   - 503 when Artifactory is unavailable, rate limits the request or can't be reached
+func artifactoryErrorStatus(err error) int {
+	var urlErr *url.Error
+	var certErr *tls.CertificateVerificationError
+
+	switch statusCode := access.StatusCode(err); {
+	case statusCode == http.StatusBadRequest, statusCode == http.StatusUnauthorized,
+		statusCode == http.StatusForbidden, statusCode == http.StatusNotFound:
+		return statusCode
+	case statusCode == http.StatusTooManyRequests, statusCode == http.StatusServiceUnavailable:
+		return http.StatusServiceUnavailable
+	case statusCode >= http.StatusInternalServerError:
+		return http.StatusBadGateway
+	case statusCode >= http.StatusBadRequest:
+		return http.StatusBadRequest
+	case errors.As(err, &certErr):
+		return http.StatusBadGateway
+	case errors.As(err, &urlErr):
+		return http.StatusServiceUnavailable
+	}
+
+	return 0
+}
+
+// artifactoryErrorResponse turns the error of an Artifactory request returned by a handler into a
+// logical.CodedError, so that the Vault response tells client errors from Artifactory outages.
+// The message of the handler's error response, if any, prefixes the error.
+func artifactoryErrorResponse(resp *logical.Response, err error) (*logical.Response, error) {
+	if err == nil {
+		return resp, nil
+	}
+
+	if _, ok := err.(logical.HTTPCodedError); ok {
+		return resp, err
+	}
+
+	status := artifactoryErrorStatus(err)
+	if status == 0 {
+		return resp, err
+	}
+
+	message := err.Error()
+	if resp != nil && resp.IsError() {
+		message = resp.Error().Error() + ": " + message
+	}
+
+	return nil, logical.CodedError(status, message)
+}
@@ -0,0 +1,114 @@
+package artifactory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifactoryErrorStatus(t *testing.T) {
+	apiError := func(statusCode int) error {
+		return fmt.Errorf("wrapped: %w", &access.APIError{Message: "could not create access token", StatusCode: statusCode})
+	}
+
+	for statusCode, expected := range map[int]int{
+		http.StatusBadRequest:          http.StatusBadRequest,
+		http.StatusUnauthorized:        http.StatusUnauthorized,
+		http.StatusForbidden:           http.StatusForbidden,
+		http.StatusNotFound:            http.StatusNotFound,
+		http.StatusConflict:            http.StatusBadRequest,
+		http.StatusTooManyRequests:     http.StatusServiceUnavailable,
+		http.StatusInternalServerError: http.StatusBadGateway,
+		http.StatusBadGateway:          http.StatusBadGateway,
+		http.StatusServiceUnavailable:  http.StatusServiceUnavailable,
+	} {
+		assert.Equal(t, expected, artifactoryErrorStatus(apiError(statusCode)), "Artifactory status %d", statusCode)
+	}
+
+	unreachable := &url.Error{Op: "Post", URL: "http://myserver.com:80/access/api/v1/tokens", Err: errors.New("connection refused")}
+	assert.Equal(t, http.StatusServiceUnavailable, artifactoryErrorStatus(unreachable))
+
+	assert.Equal(t, 0, artifactoryErrorStatus(errors.New("not an Artifactory error")))
+	assert.Equal(t, 0, artifactoryErrorStatus(access.ErrIncompatibleVersion))
+}
+
+func TestArtifactoryErrorResponse(t *testing.T) {
+	resp, err := artifactoryErrorResponse(logical.ErrorResponse("error creating new access token"),
+		&access.APIError{Message: "could not create access token", StatusCode: http.StatusForbidden})
+	assert.Nil(t, resp)
+	assert.EqualError(t, err, "error creating new access token: could not create access token: HTTP response 403")
+	assert.Equal(t, http.StatusForbidden, err.(logical.HTTPCodedError).Code())
+
+	// Other errors are left alone
+	other := errors.New("storage failure")
+	errResp := logical.ErrorResponse("error reading role")
+	resp, err = artifactoryErrorResponse(errResp, other)
+	assert.Equal(t, errResp, resp)
+	assert.Equal(t, other, err)
+
+	resp, err = artifactoryErrorResponse(&logical.Response{}, nil)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+}
+
+// Test that the Vault response of a failed token creation has the status code matching the Artifactory failure
+func TestBackend_CreateTokenErrorStatus(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":    "test-username",
+			"scope":       "applied-permissions/groups:test-group",
+			"default_ttl": 5 * time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	for artifactoryStatus, vaultStatus := range map[int]int{
+		http.StatusBadRequest:          http.StatusBadRequest,
+		http.StatusUnauthorized:        http.StatusUnauthorized,
+		http.StatusInternalServerError: http.StatusBadGateway,
+		http.StatusServiceUnavailable:  http.StatusServiceUnavailable,
+	} {
+		httpmock.RegisterResponder(
+			http.MethodPost,
+			"http://myserver.com:80/access/api/v1/tokens",
+			httpmock.NewJsonResponderOrPanic(artifactoryStatus, access.ErrorResponse{
+				Errors: []access.ErrorDetail{{Code: "ERROR", Message: "token request failed"}},
+			}))
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "token/test-role",
+			Storage:   config.StorageView,
+		})
+		assert.Nil(t, resp)
+		assert.ErrorContains(t, err, "could not create access token: HTTP response: token request failed")
+
+		var coded logical.HTTPCodedError
+		if assert.ErrorAs(t, err, &coded) {
+			assert.Equal(t, vaultStatus, coded.Code(), "Artifactory status %d", artifactoryStatus)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package artifactory
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/vault/sdk/helper/identitytpl"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// usesIdentityTemplate returns true if the value has templating directives
+func usesIdentityTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// validateIdentityTemplate checks the templating directives of the value are well-formed
+func validateIdentityTemplate(field, value string) error {
+	if !usesIdentityTemplate(value) {
+		return nil
+	}
+
+	_, _, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+		String:            value,
+		ValidityCheckOnly: true,
+		Mode:              identitytpl.ACLTemplating,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid identity template in %s: %w", field, err)
+	}
+	return nil
+}
+
+func validateIdentityTemplates(role artifactoryRole) error {
+	if err := validateIdentityTemplate("username", role.Username); err != nil {
+		return err
+	}
+	return validateIdentityTemplate("scope", role.Scope)
+}
+
+// identityTemplater evaluates identity templates for the entity of a request
+type identityTemplater struct {
+	entity *logical.Entity
+	groups []*logical.Group
+}
+
+// identityTemplaterForRequest returns an identityTemplater for the entity of the request
+func (b *backend) identityTemplaterForRequest(req *logical.Request) (*identityTemplater, error) {
+	if len(req.EntityID) == 0 {
+		return nil, fmt.Errorf("the request has no identity entity")
+	}
+
+	entity, err := b.System().EntityInfo(req.EntityID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching identity entity: %w", err)
+	}
+	if entity == nil {
+		return nil, fmt.Errorf("identity entity %q not found", req.EntityID)
+	}
+
+	groups, err := b.System().GroupsForEntity(req.EntityID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching identity groups: %w", err)
+	}
+
+	return &identityTemplater{entity: entity, groups: groups}, nil
+}
+
+// populate evaluates the identity templates of the value, a missing template value is an error
+func (t *identityTemplater) populate(field, value string) (string, error) {
+	if !usesIdentityTemplate(value) {
+		return value, nil
+	}
+
+	_, populated, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+		String:      value,
+		Entity:      t.entity,
+		Groups:      t.groups,
+		NamespaceID: t.entity.NamespaceID,
+		Mode:        identitytpl.ACLTemplating,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error evaluating identity template in %s: %w", field, err)
+	}
+	return populated, nil
+}
+
+// populateIdentityTemplates evaluates the identity templates of the role username and scope, for the entity of the request
+func (b *backend) populateIdentityTemplates(req *logical.Request, role *artifactoryRole) error {
+	if !usesIdentityTemplate(role.Username) && !usesIdentityTemplate(role.Scope) {
+		return nil
+	}
+
+	templater, err := b.identityTemplaterForRequest(req)
+	if err != nil {
+		return fmt.Errorf("role uses identity templates, but %w", err)
+	}
+
+	if role.Username, err = templater.populate("username", role.Username); err != nil {
+		return err
+	}
+
+	if role.Scope, err = templater.populateScope(role.Scope); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// populateScope evaluates the identity templates of the scope one by one, rejecting values which would change
+// the structure of the scope, such as metadata adding a scope element
+func (t *identityTemplater) populateScope(scope string) (string, error) {
+	var err error
+	populated := identityTemplateDirective.ReplaceAllStringFunc(scope, func(directive string) string {
+		if err != nil {
+			return ""
+		}
+
+		var value string
+		if value, err = t.populate("scope", directive); err != nil {
+			return ""
+		}
+
+		if strings.IndexFunc(value, isScopeSeparator) >= 0 {
+			err = fmt.Errorf("identity template %s in scope evaluates to %q, which must not contain whitespace, ',', '\"' or ':'", directive, value)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return populated, nil
+}
+
+// isScopeSeparator returns true for the characters separating or quoting the elements and names of a scope
+func isScopeSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`,":`, r)
+}
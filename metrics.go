@@ -0,0 +1,181 @@
+package artifactory
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/armon/go-metrics"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+)
+
+// metricsPrefix prefixes the keys of the metrics emitted by the backend
+var metricsPrefix = []string{"secrets", "artifactory"}
+
+// metricsSink receives the metrics of the backend. *metrics.Metrics implements it, so that tests can
+// use an in-memory sink.
+type metricsSink interface {
+	IncrCounterWithLabels(key []string, val float32, labels []metrics.Label)
+	SetGaugeWithLabels(key []string, val float32, labels []metrics.Label)
+	AddSampleWithLabels(key []string, val float32, labels []metrics.Label)
+	MeasureSinceWithLabels(key []string, start time.Time, labels []metrics.Label)
+}
+
+// statsdAddrEnv is the environment variable with the address of the statsd server receiving the metrics
+const statsdAddrEnv = "ARTIFACTORY_PLUGIN_STATSD_ADDR"
+
+// ConfigureMetrics sends the metrics of the plugin to the statsd server at the address of the
+// ARTIFACTORY_PLUGIN_STATSD_ADDR environment variable, e.g. "127.0.0.1:8125". The plugin runs in its own
+// process, where Vault's telemetry sinks aren't configured, so the metrics are discarded when the variable
+// isn't set. The returned function flushes the metrics and stops the sink.
+func ConfigureMetrics() (func(), error) {
+	addr := os.Getenv(statsdAddrEnv)
+	if addr == "" {
+		return func() {}, nil
+	}
+
+	sink, err := metrics.NewStatsdSink(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The keys already start with metricsPrefix, and are labeled rather than prefixed with the hostname
+	config := metrics.DefaultConfig("")
+	config.EnableHostname = false
+	config.EnableRuntimeMetrics = false
+
+	if _, err := metrics.NewGlobal(config, sink); err != nil {
+		return nil, err
+	}
+
+	return metrics.Shutdown, nil
+}
+
+// globalMetrics emits to the global go-metrics instance, which ConfigureMetrics configures in the plugin
+// process. It discards the metrics until then.
+type globalMetrics struct{}
+
+func (globalMetrics) IncrCounterWithLabels(key []string, val float32, labels []metrics.Label) {
+	metrics.IncrCounterWithLabels(key, val, labels)
+}
+
+func (globalMetrics) SetGaugeWithLabels(key []string, val float32, labels []metrics.Label) {
+	metrics.SetGaugeWithLabels(key, val, labels)
+}
+
+func (globalMetrics) AddSampleWithLabels(key []string, val float32, labels []metrics.Label) {
+	metrics.AddSampleWithLabels(key, val, labels)
+}
+
+func (globalMetrics) MeasureSinceWithLabels(key []string, start time.Time, labels []metrics.Label) {
+	metrics.MeasureSinceWithLabels(key, start, labels)
+}
+
+// withMetrics makes the backend emit its metrics to the sink
+func withMetrics(sink metricsSink) backendOption {
+	return func(b *backend) {
+		b.metrics = sink
+	}
+}
+
+// metricsKey returns the key of the metric, prefixed with metricsPrefix
+func metricsKey(key ...string) []string {
+	return append(append([]string{}, metricsPrefix...), key...)
+}
+
+// resultLabel returns the label of the outcome of an operation
+func resultLabel(err error) metrics.Label {
+	if err != nil {
+		return metrics.Label{Name: "result", Value: "failure"}
+	}
+	return metrics.Label{Name: "result", Value: "success"}
+}
+
+// emitTokenIssued counts an access token issued by the path for the role
+func (b *backend) emitTokenIssued(path, role string) {
+	b.metrics.IncrCounterWithLabels(metricsKey("token", "issued"), 1, []metrics.Label{
+		{Name: "path", Value: path},
+		{Name: "role", Value: role},
+	})
+}
+
+// emitCreateTokenLatency measures how long Artifactory took to create an access token for the role
+func (b *backend) emitCreateTokenLatency(role string, start time.Time, err error) {
+	b.metrics.MeasureSinceWithLabels(metricsKey("token", "create"), start, []metrics.Label{
+		{Name: "role", Value: role},
+		resultLabel(err),
+	})
+}
+
+// emitTokenRenewal counts a renewal of the lease of an access token of the role
+func (b *backend) emitTokenRenewal(role string, err error) {
+	b.metrics.IncrCounterWithLabels(metricsKey("token", "renewed"), 1, []metrics.Label{
+		{Name: "role", Value: role},
+		resultLabel(err),
+	})
+}
+
+// emitTokenRevocation counts a revocation of an access token of the role
+func (b *backend) emitTokenRevocation(role string, err error) {
+	b.metrics.IncrCounterWithLabels(metricsKey("token", "revoked"), 1, []metrics.Label{
+		{Name: "role", Value: role},
+		resultLabel(err),
+	})
+}
+
+// observeArtifactoryRequest returns the access.Config Observer of the connection, which counts the requests
+// to Artifactory by status code and measures their latency. Status code 0 means Artifactory couldn't be reached.
+func (b *backend) observeArtifactoryRequest(connection string) func(info access.RequestInfo) {
+	return func(info access.RequestInfo) {
+		labels := []metrics.Label{
+			{Name: "connection", Value: connection},
+			{Name: "method", Value: info.Method},
+			{Name: "path", Value: info.Route},
+		}
+
+		b.metrics.AddSampleWithLabels(metricsKey("request", "duration"), float32(info.Duration)/float32(time.Millisecond), labels)
+
+		labels = append(labels, metrics.Label{Name: "status_code", Value: strconv.Itoa(info.StatusCode)})
+		b.metrics.IncrCounterWithLabels(metricsKey("request"), 1, labels)
+	}
+}
+
+// reportAdminTokenExpiry sets the gauge of the seconds until the admin token of each connection expires.
+// Admin tokens which aren't JWTs or don't expire are skipped.
+func (b *backend) reportAdminTokenExpiry(ctx context.Context, storage logical.Storage) error {
+	names, err := storage.List(ctx, "config/connections/")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range append([]string{""}, names...) {
+		config, err := b.fetchConnectionConfiguration(ctx, storage, name)
+		if err != nil {
+			return err
+		}
+
+		if config == nil {
+			continue
+		}
+
+		// The expiration is only reported, so the signature doesn't need to be verified here
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(config.AccessToken, claims); err != nil {
+			continue
+		}
+
+		exp := b.tokenExpiration(claims)
+		if exp <= 0 {
+			continue
+		}
+
+		b.metrics.SetGaugeWithLabels(metricsKey("admin_token", "time_to_expiry"), float32(time.Until(time.Unix(exp, 0)).Seconds()), []metrics.Label{
+			{Name: "connection", Value: name},
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package artifactory
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/armon/go-metrics"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// inmemMetrics returns the option making the backend emit its metrics to an in-memory sink, and the sink
+func inmemMetrics(t *testing.T) (backendOption, *metrics.InmemSink) {
+	sink := metrics.NewInmemSink(time.Hour, time.Hour)
+
+	config := metrics.DefaultConfig("")
+	config.EnableHostname = false
+	config.EnableRuntimeMetrics = false
+
+	m, err := metrics.New(config, sink)
+	assert.NoError(t, err)
+
+	return withMetrics(m), sink
+}
+
+func TestBackend_TokenMetrics(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+	mockTokenAndRefreshRequests(t)
+
+	withInmemMetrics, sink := inmemMetrics(t)
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token":        "test-access-token",
+		"url":                 "http://myserver.com:80",
+		"use_expiring_tokens": true,
+	}, withInmemMetrics)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":    "test-username",
+			"scope":       "applied-permissions/user",
+			"refreshable": true,
+			"default_ttl": 5 * time.Minute,
+			"max_ttl":     10 * time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+
+	secret := resp.Secret
+	secret.Renewable = true
+	secret.IssueTime = time.Now()
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Secret:    secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/refreshed-token-id",
+		httpmock.NewStringResponder(200, ""))
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Secret:    resp.Secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+
+	// A revocation rejected by Artifactory is counted as a failure
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/refreshed-token-id",
+		httpmock.NewStringResponder(400, ""))
+	delete(resp.Secret.InternalData, "token_revoked")
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Secret:    resp.Secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+
+	data := sink.Data()[0]
+
+	assert.Equal(t, 1, data.Counters["secrets.artifactory.token.issued;path=token;role=test-role"].Count)
+	assert.Equal(t, 1, data.Samples["secrets.artifactory.token.create;role=test-role;result=success"].Count)
+	assert.Equal(t, 1, data.Counters["secrets.artifactory.token.renewed;role=test-role;result=success"].Count)
+	assert.Equal(t, 1, data.Counters["secrets.artifactory.token.revoked;role=test-role;result=success"].Count)
+	assert.Equal(t, 1, data.Counters["secrets.artifactory.token.revoked;role=test-role;result=failure"].Count)
+
+	// Requests are labeled with their route, not the ID of the token
+	assert.Equal(t, 2, data.Counters["secrets.artifactory.request;connection=;method=POST;path=/access/api/v1/tokens;status_code=200"].Count)
+	assert.Equal(t, 1, data.Counters["secrets.artifactory.request;connection=;method=DELETE;path=/access/api/v1/tokens/{id};status_code=200"].Count)
+	assert.Equal(t, 1, data.Counters["secrets.artifactory.request;connection=;method=DELETE;path=/access/api/v1/tokens/{id};status_code=400"].Count)
+	assert.Equal(t, 2, data.Samples["secrets.artifactory.request.duration;connection=;method=POST;path=/access/api/v1/tokens"].Count)
+}
+
+func TestBackend_AdminTokenExpiryMetric(t *testing.T) {
+	withInmemMetrics, sink := inmemMetrics(t)
+	b, config := makeBackend(t, withInmemMetrics)
+
+	adminToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("test-key"))
+	assert.NoError(t, err)
+
+	for path, adminConfig := range map[string]adminConfiguration{
+		"config/admin":             {AccessToken: adminToken, ArtifactoryURL: "http://myserver.com:80"},
+		"config/connections/other": {AccessToken: "not-a-jwt", ArtifactoryURL: "http://other.com:80"},
+	} {
+		entry, err := logical.StorageEntryJSON(path, adminConfig)
+		assert.NoError(t, err)
+		assert.NoError(t, config.StorageView.Put(context.Background(), entry))
+	}
+
+	assert.NoError(t, b.reportAdminTokenExpiry(context.Background(), config.StorageView))
+
+	gauges := sink.Data()[0].Gauges
+	assert.Len(t, gauges, 1)
+	assert.InDelta(t, time.Hour.Seconds(), gauges["secrets.artifactory.admin_token.time_to_expiry;connection="].Value, 60)
+}
@@ -13,31 +13,16 @@ import (
 func (b *backend) pathConfig() *framework.Path {
 	return &framework.Path{
 		Pattern: "config/admin",
-		Fields: map[string]*framework.FieldSchema{
-			"access_token": {
-				Type:        framework.TypeString,
-				Required:    true,
-				Description: "Administrator token to access Artifactory",
-			},
-			"url": {
-				Type:        framework.TypeString,
-				Required:    true,
-				Description: "Address of the Artifactory instance",
-			},
+		Fields: connectionFieldSchemas(map[string]*framework.FieldSchema{
 			"username_template": {
 				Type:        framework.TypeString,
 				Description: "Optional. Vault Username Template for dynamically generating usernames.",
 			},
-			"use_expiring_tokens": {
-				Type:        framework.TypeBool,
-				Description: "Optional. If Artifactory version >= 7.50.3, set expires_in to max_ttl and force_revocable.",
-			},
-			"bypass_artifactory_tls_verification": {
-				Type:        framework.TypeBool,
-				Default:     false,
-				Description: "Optional. Bypass certification verification for TLS connection with Artifactory. Default to `false`.",
+			"rotation_period": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Optional. Rotate the admin access token automatically at this interval, and before it expires. Defaults to 0 (disabled).",
 			},
-		},
+		}),
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
 				Callback: b.pathConfigUpdate,
@@ -67,19 +52,184 @@ additional information such as jfrog_token_id, username and scope.
 An optional "username_template" parameter will override the built-in default username_template for dynamically generating
 usernames if a static one is not provided.
 
+An optional "rotation_period" parameter enables scheduled rotation of the access token. The token is rotated once
+"rotation_period" has elapsed since the last rotation, or one hour before it expires, whichever comes first. The outcome
+of the last rotation is shown when reading config/admin.
+
 An optional "bypass_artifactory_tls_verification" parameter will enable bypassing the TLS connection verification with Artifactory.
 
+Optional "ca_cert" (PEM) and/or "ca_path" (file or directory on the Vault server) parameters configure the CA bundle used to
+verify Artifactory's certificate. Optional "client_cert" and "client_key" parameters configure a client certificate for mutual TLS.
+The "client_key" is stored seal wrapped when available and cannot be retrieved.
+
+Optional "connect_timeout" and "request_timeout" parameters bound the requests to Artifactory. Idempotent requests are
+retried on 429 and 5xx responses.
+
 No renewals or new tokens will be issued if the backend configuration (config/admin) is deleted.
 `,
 	}
 }
 
+// connectionFieldSchemas returns the fields used to connect to an Artifactory instance,
+// shared by config/admin and config/connections/<name>, merged with the provided fields.
+func connectionFieldSchemas(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	schemas := map[string]*framework.FieldSchema{
+		"access_token": {
+			Type:        framework.TypeString,
+			Required:    true,
+			Description: "Administrator token to access Artifactory",
+		},
+		"url": {
+			Type:        framework.TypeString,
+			Required:    true,
+			Description: "Address of the Artifactory instance",
+		},
+		"use_expiring_tokens": {
+			Type:        framework.TypeBool,
+			Description: "Optional. If Artifactory version >= 7.50.3, set expires_in to max_ttl and force_revocable.",
+		},
+		"bypass_artifactory_tls_verification": {
+			Type:        framework.TypeBool,
+			Default:     false,
+			Description: "Optional. Bypass certification verification for TLS connection with Artifactory. Default to `false`.",
+		},
+		"ca_cert": {
+			Type:        framework.TypeString,
+			Description: "Optional. PEM encoded CA certificate(s) used to verify the TLS connection with Artifactory. Replaces the system CA pool.",
+		},
+		"ca_path": {
+			Type:        framework.TypeString,
+			Description: "Optional. Path on the Vault server to a PEM encoded CA certificate file, or a directory of them, used to verify the TLS connection with Artifactory. Replaces the system CA pool.",
+		},
+		"client_cert": {
+			Type:        framework.TypeString,
+			Description: "Optional. PEM encoded client certificate for mutual TLS with Artifactory. Requires client_key.",
+		},
+		"client_key": {
+			Type:        framework.TypeString,
+			Description: "Optional. PEM encoded private key for client_cert. This value is stored seal wrapped when available and cannot be read back.",
+		},
+		"connect_timeout": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Optional. Defaults to 10 seconds. Timeout for connecting to Artifactory, including the TLS handshake.",
+		},
+		"request_timeout": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Optional. Defaults to 60 seconds. Timeout for each request to Artifactory, including its retries and reading the response. Idempotent requests are retried up to 3 times on 429 and 5xx responses.",
+		},
+	}
+
+	for name, schema := range fields {
+		schemas[name] = schema
+	}
+
+	return schemas
+}
+
 type adminConfiguration struct {
-	AccessToken                      string `json:"access_token"`
-	ArtifactoryURL                   string `json:"artifactory_url"`
-	UsernameTemplate                 string `json:"username_template,omitempty"`
-	UseExpiringTokens                bool   `json:"use_expiring_tokens,omitempty"`
-	BypassArtifactoryTLSVerification bool   `json:"bypass_artifactory_tls_verification,omitempty"`
+	AccessToken                      string        `json:"access_token"`
+	ArtifactoryURL                   string        `json:"artifactory_url"`
+	UsernameTemplate                 string        `json:"username_template,omitempty"`
+	UseExpiringTokens                bool          `json:"use_expiring_tokens,omitempty"`
+	BypassArtifactoryTLSVerification bool          `json:"bypass_artifactory_tls_verification,omitempty"`
+	CACert                           string        `json:"ca_cert,omitempty"`
+	CAPath                           string        `json:"ca_path,omitempty"`
+	ClientCert                       string        `json:"client_cert,omitempty"`
+	ClientKey                        string        `json:"client_key,omitempty"`
+	RotationPeriod                   time.Duration `json:"rotation_period,omitempty"`
+	ConnectTimeout                   time.Duration `json:"connect_timeout,omitempty"`
+	RequestTimeout                   time.Duration `json:"request_timeout,omitempty"`
+
+	// name of the connection this configuration was read from, empty for config/admin
+	name string
+}
+
+// updateConnectionConfiguration applies the connection fields from the request to the configuration
+func updateConnectionConfiguration(config *adminConfiguration, data *framework.FieldData) *logical.Response {
+	if val, ok := data.GetOk("url"); ok {
+		config.ArtifactoryURL = val.(string)
+		config.AccessToken = "" // clear access token if URL changes, requires setting access_token and url together for security reasons
+	}
+
+	if val, ok := data.GetOk("access_token"); ok {
+		config.AccessToken = val.(string)
+	}
+
+	if val, ok := data.GetOk("use_expiring_tokens"); ok {
+		config.UseExpiringTokens = val.(bool)
+	}
+
+	if val, ok := data.GetOk("bypass_artifactory_tls_verification"); ok {
+		config.BypassArtifactoryTLSVerification = val.(bool)
+	}
+
+	if val, ok := data.GetOk("ca_cert"); ok {
+		config.CACert = val.(string)
+	}
+
+	if val, ok := data.GetOk("ca_path"); ok {
+		config.CAPath = val.(string)
+	}
+
+	if val, ok := data.GetOk("client_cert"); ok {
+		config.ClientCert = val.(string)
+	}
+
+	if val, ok := data.GetOk("client_key"); ok {
+		config.ClientKey = val.(string)
+	}
+
+	if val, ok := data.GetOk("connect_timeout"); ok {
+		config.ConnectTimeout = time.Duration(val.(int)) * time.Second
+	}
+
+	if val, ok := data.GetOk("request_timeout"); ok {
+		config.RequestTimeout = time.Duration(val.(int)) * time.Second
+	}
+
+	if config.ConnectTimeout < 0 || config.RequestTimeout < 0 {
+		return logical.ErrorResponse("connect_timeout and request_timeout must not be negative")
+	}
+
+	if len(config.ClientCert) > 0 != (len(config.ClientKey) > 0) {
+		return logical.ErrorResponse("client_cert and client_key must be set together")
+	}
+
+	if config.AccessToken == "" {
+		return logical.ErrorResponse("access_token is required")
+	}
+
+	if config.ArtifactoryURL == "" {
+		return logical.ErrorResponse("url is required")
+	}
+
+	return nil
+}
+
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultRequestTimeout = time.Minute
+)
+
+// connectTimeout returns the timeout for connecting to Artifactory, or the default
+func (c adminConfiguration) connectTimeout() time.Duration {
+	if c.ConnectTimeout > 0 {
+		return c.ConnectTimeout
+	}
+	return defaultConnectTimeout
+}
+
+// requestTimeout returns the timeout of each request to Artifactory, including its retries, or the default
+func (c adminConfiguration) requestTimeout() time.Duration {
+	if c.RequestTimeout > 0 {
+		return c.RequestTimeout
+	}
+	return defaultRequestTimeout
+}
+
+// hasCustomTLS returns true if the configuration requires a dedicated TLS transport
+func (c adminConfiguration) hasCustomTLS() bool {
+	return len(c.CACert) > 0 || len(c.CAPath) > 0 || len(c.ClientCert) > 0
 }
 
 func (b *backend) pathConfigUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -95,15 +245,6 @@ func (b *backend) pathConfigUpdate(ctx context.Context, req *logical.Request, da
 		config = &adminConfiguration{}
 	}
 
-	if val, ok := data.GetOk("url"); ok {
-		config.ArtifactoryURL = val.(string)
-		config.AccessToken = "" // clear access token if URL changes, requires setting access_token and url together for security reasons
-	}
-
-	if val, ok := data.GetOk("access_token"); ok {
-		config.AccessToken = val.(string)
-	}
-
 	if val, ok := data.GetOk("username_template"); ok {
 		config.UsernameTemplate = val.(string)
 		up, err := testUsernameTemplate(config.UsernameTemplate)
@@ -113,27 +254,28 @@ func (b *backend) pathConfigUpdate(ctx context.Context, req *logical.Request, da
 		b.usernameProducer = up
 	}
 
-	if val, ok := data.GetOk("use_expiring_tokens"); ok {
-		config.UseExpiringTokens = val.(bool)
+	if val, ok := data.GetOk("rotation_period"); ok {
+		config.RotationPeriod = time.Duration(val.(int)) * time.Second
 	}
 
-	if val, ok := data.GetOk("bypass_artifactory_tls_verification"); ok {
-		config.BypassArtifactoryTLSVerification = val.(bool)
+	if config.RotationPeriod < 0 {
+		return logical.ErrorResponse("rotation_period must not be negative"), nil
 	}
 
-	if config.AccessToken == "" {
-		return logical.ErrorResponse("access_token is required"), nil
-	}
+	oldAccessToken := config.AccessToken
 
-	if config.ArtifactoryURL == "" {
-		return logical.ErrorResponse("url is required"), nil
+	if resp := updateConnectionConfiguration(config, data); resp != nil {
+		return resp, nil
 	}
 
-	b.InitializeHttpClient(config)
+	err = b.InitializeHttpClient(config)
+	if err != nil {
+		return logical.ErrorResponse("invalid TLS configuration: %s", err), nil
+	}
 
 	go b.sendUsage(*config, "pathConfigRotateUpdate")
 
-	err = b.getVersion(*config)
+	err = b.getVersion(ctx, *config)
 	if err != nil {
 		return logical.ErrorResponse("Unable to get Artifactory Version. Check url and access_token fields. TLS connection verification with Artifactory can be skipped by setting bypass_artifactory_tls_verification field to 'true'"), err
 	}
@@ -148,6 +290,19 @@ func (b *backend) pathConfigUpdate(ctx context.Context, req *logical.Request, da
 		return nil, err
 	}
 
+	status, err := b.fetchRotationStatus(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// A newly written access token (re)starts the rotation schedule
+	if config.AccessToken != oldAccessToken || status.LastRotation.IsZero() {
+		err = b.storeRotationStatus(ctx, req.Storage, &rotationStatus{LastRotation: time.Now()})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return nil, nil
 }
 
@@ -170,6 +325,12 @@ func (b *backend) pathConfigDelete(ctx context.Context, req *logical.Request, _
 		return nil, err
 	}
 
+	if err := req.Storage.Delete(ctx, "config/rotation"); err != nil {
+		return nil, err
+	}
+
+	b.reset("")
+
 	return nil, nil
 }
 
@@ -188,23 +349,62 @@ func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, _ *f
 
 	go b.sendUsage(*config, "pathConfigRead")
 
+	configMap := b.connectionConfigurationToMap(ctx, *config)
+
+	// Optionally include username_template
+	if len(config.UsernameTemplate) > 0 {
+		configMap["username_template"] = config.UsernameTemplate
+	}
+
+	status, err := b.fetchRotationStatus(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	configMap["rotation_period"] = config.RotationPeriod.Seconds()
+	if !status.LastRotation.IsZero() {
+		configMap["last_rotation"] = status.LastRotation.Local()
+	}
+	if next := b.nextRotation(*config, *status); !next.IsZero() {
+		configMap["next_rotation"] = next.Local()
+	}
+	if len(status.LastRotationError) > 0 {
+		configMap["last_rotation_error"] = status.LastRotationError
+		configMap["last_rotation_error_time"] = status.LastRotationErrorTime.Local()
+	}
+
+	return &logical.Response{
+		Data: configMap,
+	}, nil
+}
+
+// connectionConfigurationToMap returns the readable attributes of a connection configuration
+func (b *backend) connectionConfigurationToMap(ctx context.Context, config adminConfiguration) map[string]interface{} {
 	// I'm not sure if I should be returning the access token, so I'll hash it.
 	accessTokenHash := sha256.Sum256([]byte(config.AccessToken))
 
 	configMap := map[string]interface{}{
 		"access_token_sha256":                 fmt.Sprintf("%x", accessTokenHash[:]),
 		"url":                                 config.ArtifactoryURL,
-		"version":                             b.version,
+		"version":                             b.connectionVersion(ctx, config),
 		"bypass_artifactory_tls_verification": config.BypassArtifactoryTLSVerification,
+		"connect_timeout":                     int64(config.connectTimeout().Seconds()),
+		"request_timeout":                     int64(config.requestTimeout().Seconds()),
 	}
 
-	// Optionally include username_template
-	if len(config.UsernameTemplate) > 0 {
-		configMap["username_template"] = config.UsernameTemplate
+	// Optionally include TLS settings, the client_key is never returned
+	if len(config.CACert) > 0 {
+		configMap["ca_cert"] = config.CACert
+	}
+	if len(config.CAPath) > 0 {
+		configMap["ca_path"] = config.CAPath
+	}
+	if len(config.ClientCert) > 0 {
+		configMap["client_cert"] = config.ClientCert
 	}
 
 	// Optionally include token info if it parses properly
-	token, err := b.getTokenInfo(*config, config.AccessToken)
+	token, err := b.getTokenInfo(ctx, config, config.AccessToken)
 	if err != nil {
 		b.Logger().Warn("Error parsing AccessToken: " + err.Error())
 	} else {
@@ -218,11 +418,9 @@ func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, _ *f
 		}
 	}
 
-	if b.supportForceRevocable() {
+	if b.supportForceRevocable(ctx, config) {
 		configMap["use_expiring_tokens"] = config.UseExpiringTokens
 	}
 
-	return &logical.Response{
-		Data: configMap,
-	}, nil
+	return configMap
 }
@@ -0,0 +1,263 @@
+package artifactory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathListConnections() *framework.Path {
+	return &framework.Path{
+		Pattern: "config/connections/?$",
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathConnectionList,
+			},
+		},
+		HelpSynopsis: `List configured Artifactory connections with this backend.`,
+	}
+}
+
+func (b *backend) pathConfigConnections() *framework.Path {
+	return &framework.Path{
+		Pattern: "config/connections/" + framework.GenericNameRegex("name"),
+		Fields: connectionFieldSchemas(map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: "The name of the connection, referenced by roles using the 'connection' parameter.",
+			},
+		}),
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.CreateOperation: &framework.PathOperation{
+				Callback: b.pathConnectionWrite,
+				Summary:  "Configure a named Artifactory connection.",
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConnectionWrite,
+				Summary:  "Configure a named Artifactory connection.",
+			},
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConnectionRead,
+				Summary:  "Examine a named Artifactory connection.",
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathConnectionDelete,
+				Summary:  "Delete a named Artifactory connection.",
+			},
+		},
+		ExistenceCheck: b.connectionExistenceCheck,
+		HelpSynopsis:   `Interact with named Artifactory connections.`,
+		HelpDescription: `
+Configure additional Artifactory instances that roles can issue tokens from, so that a single mount can serve
+several JFrog platforms (e.g. prod, DR, EU).
+
+Each connection has its own "url", "access_token", "use_expiring_tokens", "bypass_artifactory_tls_verification",
+"ca_cert", "ca_path", "client_cert", "client_key", "connect_timeout" and "request_timeout" parameters, which have the same meaning as on config/admin. The Artifactory version is detected per connection.
+
+Roles select a connection with their "connection" parameter. Roles without a connection use config/admin. Tokens
+are renewed and revoked against the connection that issued them, so a connection can't be deleted while roles,
+static roles or outstanding access tokens still use it.
+`,
+	}
+}
+
+func (b *backend) pathConnectionList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	entries, err := req.Storage.List(ctx, "config/connections/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathConnectionWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	name := data.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing name"), nil
+	}
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		config = &adminConfiguration{name: name}
+	}
+
+	if resp := updateConnectionConfiguration(config, data); resp != nil {
+		return resp, nil
+	}
+
+	err = b.InitializeHttpClient(config)
+	if err != nil {
+		return logical.ErrorResponse("invalid TLS configuration: %s", err), nil
+	}
+
+	go b.sendUsage(*config, "pathConnectionWrite")
+
+	err = b.getVersion(ctx, *config)
+	if err != nil {
+		return logical.ErrorResponse("Unable to get Artifactory Version. Check url and access_token fields. TLS connection verification with Artifactory can be skipped by setting bypass_artifactory_tls_verification field to 'true'"), err
+	}
+
+	entry, err := logical.StorageEntryJSON(connectionStoragePath(name), config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = req.Storage.Put(ctx, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathConnectionRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return nil, nil
+	}
+
+	go b.sendUsage(*config, "pathConnectionRead")
+
+	return &logical.Response{
+		Data: b.connectionConfigurationToMap(ctx, *config),
+	}, nil
+}
+
+func (b *backend) pathConnectionDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rolesMutex.RLock()
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+	defer b.rolesMutex.RUnlock()
+
+	name := data.Get("name").(string)
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return notConfiguredResponse(name), nil
+	}
+
+	go b.sendUsage(*config, "pathConnectionDelete")
+
+	references, err := b.connectionReferences(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(references) > 0 {
+		return logical.ErrorResponse("connection %q is still used by %s; delete or update them, and revoke their leases, first", name, strings.Join(references, ", ")), nil
+	}
+
+	if err := req.Storage.Delete(ctx, connectionStoragePath(name)); err != nil {
+		return nil, err
+	}
+
+	b.reset(name)
+
+	return nil, nil
+}
+
+// connectionReferences describes the roles, static roles and access tokens which still need the named connection.
+// The caller must hold rolesMutex and configMutex.
+func (b *backend) connectionReferences(ctx context.Context, storage logical.Storage, name string) ([]string, error) {
+	var references []string
+
+	roles, err := storage.List(ctx, "roles/")
+	if err != nil {
+		return nil, err
+	}
+	for _, roleName := range roles {
+		role, err := b.Role(ctx, storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.Connection == name {
+			references = append(references, "roles/"+roleName)
+		}
+	}
+
+	staticRoles, err := storage.List(ctx, "static-roles/")
+	if err != nil {
+		return nil, err
+	}
+	for _, roleName := range staticRoles {
+		role, err := b.StaticRole(ctx, storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.Connection == name {
+			references = append(references, "static-roles/"+roleName)
+		}
+	}
+
+	// Leases are renewed and revoked against the connection that issued their access token
+	tokenIDs, err := storage.List(ctx, issuedTokensPrefix)
+	if err != nil {
+		return nil, err
+	}
+	issued := 0
+	for _, tokenID := range tokenIDs {
+		token, err := b.fetchIssuedToken(ctx, storage, tokenID)
+		if err != nil {
+			return nil, err
+		}
+		if token != nil && token.Connection == name {
+			issued++
+		}
+	}
+	if issued > 0 {
+		references = append(references, fmt.Sprintf("%d outstanding access token(s)", issued))
+	}
+
+	pendingIDs, err := storage.List(ctx, pendingRevocationsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	pending := 0
+	for _, tokenID := range pendingIDs {
+		revocation, err := b.fetchPendingRevocation(ctx, storage, tokenID)
+		if err != nil {
+			return nil, err
+		}
+		if revocation == nil {
+			continue
+		}
+		if connection, _ := revocation.Secret["connection"].(string); connection == name {
+			pending++
+		}
+	}
+	if pending > 0 {
+		references = append(references, fmt.Sprintf("%d pending revocation(s)", pending))
+	}
+
+	return references, nil
+}
+
+func (b *backend) connectionExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, data.Get("name").(string))
+	return config != nil, err
+}
@@ -0,0 +1,311 @@
+package artifactory
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockArtifactoryConnectionRequests(baseURL, version string) {
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		baseURL+"/artifactory/api/system/usage",
+		httpmock.NewStringResponder(200, ""))
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		baseURL+"/artifactory/api/system/version",
+		httpmock.NewStringResponder(200, version))
+}
+
+func TestBackend_PathConnectionWriteReadList(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryConnectionRequests("http://eu.myserver.com:80", `{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	b, config := makeBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connections/eu",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"access_token":        "eu-access-token",
+			"url":                 "http://eu.myserver.com:80",
+			"use_expiring_tokens": true,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connections/eu",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.EqualValues(t, "http://eu.myserver.com:80", resp.Data["url"])
+	assert.EqualValues(t, "7.55.6", resp.Data["version"])
+	assert.EqualValues(t, true, resp.Data["use_expiring_tokens"])
+	assert.NotEmpty(t, resp.Data["access_token_sha256"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "config/connections",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.EqualValues(t, []string{"eu"}, resp.Data["keys"])
+
+	// The default connection is not configured
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "config/connections/eu",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connections/eu",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func TestBackend_PathConnectionRequiresURLAndAccessToken(t *testing.T) {
+	b, config := makeBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connections/eu",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"url": "http://eu.myserver.com:80",
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "access_token")
+}
+
+// A role must not reference a connection which does not exist
+func TestBackend_PathRoleWithUnknownConnection(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests("")
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"scope":      "applied-permissions/groups:test-group",
+			"connection": "eu",
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `connection "eu" not configured`)
+}
+
+// Tokens must be created and revoked on the connection configured on the role
+func TestBackend_CreateAndRevokeTokenOnConnection(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests("")
+	mockArtifactoryConnectionRequests("http://eu.myserver.com:80", `{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://eu.myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://eu.myserver.com:80/access/api/v1/tokens/59e39159-19eb-463d-953d-1d6baf567db6",
+		httpmock.NewStringResponder(200, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80/artifactory",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connections/eu",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"access_token": "eu-access-token",
+			"url":          "http://eu.myserver.com:80",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":    "test-username",
+			"scope":       "applied-permissions/groups:test-group",
+			"connection":  "eu",
+			"default_ttl": 5 * time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.EqualValues(t, "eu", resp.Data["connection"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.EqualValues(t, "59e39159-19eb-463d-953d-1d6baf567db6", resp.Data["token_id"])
+	assert.EqualValues(t, "eu", resp.Secret.InternalData["connection"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Secret:    resp.Secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["POST http://eu.myserver.com:80/access/api/v1/tokens"])
+	assert.Equal(t, 1, info["DELETE http://eu.myserver.com:80/access/api/v1/tokens/59e39159-19eb-463d-953d-1d6baf567db6"])
+}
+
+// A connection can't be deleted while roles or leases use it
+func TestBackend_PathConnectionDeleteInUse(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests("")
+	mockArtifactoryConnectionRequests("http://eu.myserver.com:80", `{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://eu.myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://eu.myserver.com:80/access/api/v1/tokens/59e39159-19eb-463d-953d-1d6baf567db6",
+		httpmock.NewStringResponder(200, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80/artifactory",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connections/eu",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"access_token": "eu-access-token",
+			"url":          "http://eu.myserver.com:80",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":    "test-username",
+			"scope":       "applied-permissions/groups:test-group",
+			"connection":  "eu",
+			"default_ttl": 5 * time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	token, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, token)
+
+	deleteConnection := func() *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "config/connections/eu",
+			Storage:   config.StorageView,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp = deleteConnection()
+	assert.True(t, resp.IsError())
+	assert.ErrorContains(t, resp.Error(), `connection "eu" is still used by roles/test-role, 1 outstanding access token(s)`)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// The lease of the access token still needs the connection to be revoked
+	resp = deleteConnection()
+	assert.True(t, resp.IsError())
+	assert.ErrorContains(t, resp.Error(), `connection "eu" is still used by 1 outstanding access token(s)`)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Secret:    token.Secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	assert.Nil(t, deleteConnection())
+}
@@ -2,7 +2,10 @@ package artifactory
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -31,6 +34,23 @@ func (b *backend) pathConfigRotate() *framework.Path {
 	}
 }
 
+const (
+	defaultAdminTokenUsername    = "admin-vault-secrets-artifactory"
+	defaultAdminTokenDescription = "Rotated access token for artifactory-secrets plugin in Vault"
+
+	// adminTokenExpiryMargin is how long before the admin token's expiration a scheduled rotation happens
+	adminTokenExpiryMargin = time.Hour
+	// rotationRetryInterval is the minimum time between scheduled rotation attempts after a failure
+	rotationRetryInterval = 5 * time.Minute
+)
+
+// rotationStatus records the outcome of admin token rotations, stored at config/rotation
+type rotationStatus struct {
+	LastRotation          time.Time `json:"last_rotation,omitempty"`
+	LastRotationError     string    `json:"last_rotation_error,omitempty"`
+	LastRotationErrorTime time.Time `json:"last_rotation_error_time,omitempty"`
+}
+
 func (b *backend) pathConfigRotateWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	b.configMutex.Lock()
 	defer b.configMutex.Unlock()
@@ -46,40 +66,109 @@ func (b *backend) pathConfigRotateWrite(ctx context.Context, req *logical.Reques
 
 	go b.sendUsage(*config, "pathConfigRotateWrite")
 
+	// Check for submitted username
+	username := ""
+	if val, ok := data.GetOk("username"); ok {
+		username = val.(string)
+		if len(username) == 0 {
+			username = defaultAdminTokenUsername
+		}
+	}
+
+	// Check for new description
+	description := b.tokenDescription(defaultAdminTokenDescription)
+	if val, ok := data.GetOk("description"); ok {
+		description = val.(string)
+	}
+
+	return b.rotateAdminToken(ctx, req.Storage, config, username, description)
+}
+
+// rotateAdminToken creates a new admin access token, saves it to config/admin then revokes the old access token.
+// If username is empty, the username of the existing access token is kept. The outcome is recorded in config/rotation.
+// The rotation succeeds once the new access token is saved: a failed revocation of the old access token is queued
+// for retry, rather than rotating again.
+func (b *backend) rotateAdminToken(ctx context.Context, storage logical.Storage, config *adminConfiguration, username, description string) (*logical.Response, error) {
 	oldAccessToken := config.AccessToken
 
+	oldTokenID, resp, err := b.performAdminTokenRotation(ctx, storage, config, username, description)
+
+	status, statusErr := b.fetchRotationStatus(ctx, storage)
+	if statusErr != nil {
+		return nil, statusErr
+	}
+
+	if err != nil || resp.IsError() {
+		status.LastRotationErrorTime = time.Now()
+		if err != nil {
+			status.LastRotationError = err.Error()
+		} else {
+			status.LastRotationError = resp.Error().Error()
+		}
+	} else {
+		status.LastRotation = time.Now()
+		status.LastRotationError = ""
+		status.LastRotationErrorTime = time.Time{}
+	}
+
+	if statusErr := b.storeRotationStatus(ctx, storage, status); statusErr != nil {
+		return nil, statusErr
+	}
+
+	if err != nil || resp.IsError() {
+		return resp, err
+	}
+
+	// Invalidate Old Token
+	err = b.revokeAccessToken(ctx, *config, oldAccessToken, oldTokenID)
+	if err == nil {
+		return nil, nil
+	}
+
+	b.Logger().Warn("error revoking previous admin access token, queued for retry", "tokenId", oldTokenID, "err", err)
+
+	err = b.enqueueRevocation(ctx, storage, map[string]interface{}{
+		"access_token": oldAccessToken,
+		"token_id":     oldTokenID,
+		"connection":   config.name,
+	}, err)
+	if err != nil {
+		return nil, fmt.Errorf("error queueing revocation of previous access token %s: %w", oldTokenID, err)
+	}
+
+	resp = &logical.Response{}
+	resp.AddWarning(fmt.Sprintf("The previous access token %s could not be revoked, its revocation is queued under revocations/pending.", oldTokenID))
+	return resp, nil
+}
+
+// performAdminTokenRotation creates a new admin access token and saves it to config/admin, returning the ID of
+// the old access token
+func (b *backend) performAdminTokenRotation(ctx context.Context, storage logical.Storage, config *adminConfiguration, username, description string) (string, *logical.Response, error) {
 	// Parse Current Token (to get tokenID/scope)
-	token, err := b.getTokenInfo(*config, oldAccessToken)
+	token, err := b.getTokenInfo(ctx, *config, config.AccessToken)
 	if err != nil {
-		return logical.ErrorResponse("error parsing existing access token: " + err.Error()), err
+		return "", logical.ErrorResponse("error parsing existing access token: " + err.Error()), err
 	}
 
-	// Check for submitted username
-	if val, ok := data.GetOk("username"); ok {
-		token.Username = val.(string)
+	if len(username) > 0 {
+		token.Username = username
 	}
 
 	if len(token.Username) == 0 {
-		token.Username = "admin-vault-secrets-artifactory" // default username if empty
+		token.Username = defaultAdminTokenUsername // default username if empty
 	}
 
 	// Create admin role for the new token
 	role := &artifactoryRole{
-		Username: token.Username,
-		Scope:    token.Scope,
-	}
-
-	// Check for new description
-	if val, ok := data.GetOk("description"); ok {
-		role.Description = val.(string)
-	} else {
-		role.Description = "Rotated access token for artifactory-secrets plugin in Vault"
+		Username:    token.Username,
+		Scope:       token.Scope,
+		Description: description,
 	}
 
 	// Create a new token
-	resp, err := b.CreateToken(*config, *role)
+	resp, err := b.CreateToken(ctx, *config, *role)
 	if err != nil {
-		return logical.ErrorResponse("error creating new access token"), err
+		return "", logical.ErrorResponse("error creating new access token"), err
 	}
 
 	// Set new token
@@ -88,25 +177,106 @@ func (b *backend) pathConfigRotateWrite(ctx context.Context, req *logical.Reques
 	// Save new config
 	entry, err := logical.StorageEntryJSON("config/admin", config)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
-	err = req.Storage.Put(ctx, entry)
+	err = storage.Put(ctx, entry)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token.TokenID, nil, nil
+}
+
+// fetchRotationStatus returns the recorded admin token rotation status, or an empty status
+func (b *backend) fetchRotationStatus(ctx context.Context, storage logical.Storage) (*rotationStatus, error) {
+	var status rotationStatus
+
+	entry, err := storage.Get(ctx, "config/rotation")
 	if err != nil {
 		return nil, err
 	}
 
-	// Invalidate Old Token
-	oldSecret := logical.Secret{
-		InternalData: map[string]interface{}{
-			"access_token": oldAccessToken,
-			"token_id":     token.TokenID,
-		},
+	if entry == nil {
+		return &status, nil
+	}
+
+	if err := entry.DecodeJSON(&status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+func (b *backend) storeRotationStatus(ctx context.Context, storage logical.Storage, status *rotationStatus) error {
+	entry, err := logical.StorageEntryJSON("config/rotation", status)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+// nextRotation returns when the admin token is due for a scheduled rotation: one rotation_period after
+// the last rotation, or adminTokenExpiryMargin before the token expires, whichever comes first.
+// The zero time is returned when scheduled rotation is disabled.
+func (b *backend) nextRotation(config adminConfiguration, status rotationStatus) time.Time {
+	if config.RotationPeriod <= 0 {
+		return time.Time{}
+	}
+
+	next := status.LastRotation.Add(config.RotationPeriod)
+
+	// The expiration is only used for scheduling, so the signature doesn't need to be verified here
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(config.AccessToken, claims); err == nil {
+		if exp := b.tokenExpiration(claims); exp > 0 {
+			if beforeExpiry := time.Unix(exp, 0).Add(-adminTokenExpiryMargin); beforeExpiry.Before(next) {
+				next = beforeExpiry
+			}
+		}
 	}
-	err = b.RevokeToken(*config, oldSecret)
+
+	return next
+}
+
+// periodicRotateAdminToken rotates the admin token when it is due for a scheduled rotation
+func (b *backend) periodicRotateAdminToken(ctx context.Context, storage logical.Storage) error {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	config, err := b.fetchAdminConfiguration(ctx, storage)
 	if err != nil {
-		return logical.ErrorResponse("error revoking existing access token %s", token.TokenID), err
+		return err
+	}
+
+	if config == nil || config.RotationPeriod <= 0 {
+		return nil
+	}
+
+	status, err := b.fetchRotationStatus(ctx, storage)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if now.Before(b.nextRotation(*config, *status)) {
+		return nil
+	}
+
+	if now.Before(status.LastRotationErrorTime.Add(rotationRetryInterval)) {
+		return nil
+	}
+
+	b.Logger().Info("rotating admin access token on schedule")
+
+	resp, err := b.rotateAdminToken(ctx, storage, config, "", b.tokenDescription(defaultAdminTokenDescription))
+	if err != nil {
+		return fmt.Errorf("scheduled rotation of admin access token failed: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("scheduled rotation of admin access token failed: %w", resp.Error())
 	}
 
-	return nil, nil
+	return nil
 }
@@ -1,9 +1,13 @@
 package artifactory
 
 import (
+	"context"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -94,3 +98,183 @@ func (e *accTestEnv) PathConfigRotateBadAccessToken(t *testing.T) {
 	assert.Contains(t, resp.Data["error"], "could not get the certificate")
 	assert.Error(t, err)
 }
+
+func TestBackend_ScheduledAdminTokenRotation(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	signer := newTestTokenSigner(t)
+	oldAccessToken := signer.accessToken(t, "old-token-id", "admin", "applied-permissions/admin", 48*time.Hour)
+	newAccessToken := signer.accessToken(t, "new-token-id", "admin", "applied-permissions/admin", 0)
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/cert/root",
+		httpmock.NewStringResponder(200, signer.rootCert))
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, signer.createTokenResponse(t, "new-token-id", newAccessToken)))
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/old-token-id",
+		httpmock.NewStringResponder(200, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token":    oldAccessToken,
+		"url":             "http://myserver.com:80",
+		"rotation_period": 24 * 60 * 60,
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 24*time.Hour.Seconds(), resp.Data["rotation_period"])
+	assert.NotEmpty(t, resp.Data["last_rotation"])
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), resp.Data["next_rotation"].(time.Time), time.Minute)
+
+	// Not due yet
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+
+	// Due
+	err = b.storeRotationStatus(context.Background(), config.StorageView, &rotationStatus{
+		LastRotation: time.Now().Add(-25 * time.Hour),
+	})
+	assert.NoError(t, err)
+
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE http://myserver.com:80/access/api/v1/tokens/old-token-id"])
+
+	adminConfig, err := b.fetchAdminConfiguration(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+	assert.Equal(t, newAccessToken, adminConfig.AccessToken)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "new-token-id", resp.Data["token_id"])
+	assert.WithinDuration(t, time.Now(), resp.Data["last_rotation"].(time.Time), time.Minute)
+	assert.NotContains(t, resp.Data, "last_rotation_error")
+}
+
+// A failed revocation of the old token is queued, the rotation itself succeeded and isn't repeated
+func TestBackend_ScheduledAdminTokenRotationQueuesFailedRevocation(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	signer := newTestTokenSigner(t)
+	oldAccessToken := signer.accessToken(t, "old-token-id", "admin", "applied-permissions/admin", 48*time.Hour)
+	newAccessToken := signer.accessToken(t, "new-token-id", "admin", "applied-permissions/admin", 0)
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/cert/root",
+		httpmock.NewStringResponder(200, signer.rootCert))
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, signer.createTokenResponse(t, "new-token-id", newAccessToken)))
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/old-token-id",
+		httpmock.NewStringResponder(400, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token":    oldAccessToken,
+		"url":             "http://myserver.com:80",
+		"rotation_period": 24 * 60 * 60,
+	})
+
+	err := b.storeRotationStatus(context.Background(), config.StorageView, &rotationStatus{
+		LastRotation: time.Now().Add(-25 * time.Hour),
+	})
+	assert.NoError(t, err)
+
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE http://myserver.com:80/access/api/v1/tokens/old-token-id"])
+
+	adminConfig, err := b.fetchAdminConfiguration(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+	assert.Equal(t, newAccessToken, adminConfig.AccessToken)
+
+	status, err := b.fetchRotationStatus(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), status.LastRotation, time.Minute)
+	assert.Empty(t, status.LastRotationError)
+
+	pending, err := b.fetchPendingRevocation(context.Background(), config.StorageView, "old-token-id")
+	assert.NoError(t, err)
+	if assert.NotNil(t, pending) {
+		assert.Equal(t, oldAccessToken, pending.Secret["access_token"])
+	}
+
+	// Not due anymore
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+}
+
+// A token about to expire must be rotated before the rotation period elapses
+func TestBackend_ScheduledAdminTokenRotationBeforeExpiry(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	signer := newTestTokenSigner(t)
+	oldAccessToken := signer.accessToken(t, "old-token-id", "admin", "applied-permissions/admin", 30*time.Minute)
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/cert/root",
+		httpmock.NewStringResponder(200, signer.rootCert))
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(500, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token":    oldAccessToken,
+		"url":             "http://myserver.com:80",
+		"rotation_period": 24 * 60 * 60,
+	})
+
+	err := b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.ErrorContains(t, err, "scheduled rotation of admin access token failed")
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, resp.Data["last_rotation_error"], "could not create access token")
+	assert.NotEmpty(t, resp.Data["last_rotation_error_time"])
+
+	// Failed rotations are not retried on every tick
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+}
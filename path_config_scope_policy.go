@@ -0,0 +1,209 @@
+package artifactory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const scopePolicyPath = "config/scope_policy"
+
+func (b *backend) pathConfigScopePolicy() *framework.Path {
+	return &framework.Path{
+		Pattern: scopePolicyPath,
+		Fields: map[string]*framework.FieldSchema{
+			"allowed_scopes": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Optional. Glob patterns of the scopes roles can grant. Scopes are matched one permission at a time, so 'applied-permissions/groups:team-*' allows any groups starting with 'team-', and 'applied-permissions/roles:myproj:*' any role in the myproj project. If unset, any scope is allowed.`,
+			},
+			"verify_groups": {
+				Type:        framework.TypeBool,
+				Description: `Optional. Defaults to 'false'. Verify that the groups named in the scope of roles exist in Artifactory, when roles are written.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConfigScopePolicyUpdate,
+				Summary:  "Configure the scopes roles can grant.",
+			},
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigScopePolicyRead,
+				Summary:  "Examine the scopes roles can grant.",
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathConfigScopePolicyDelete,
+				Summary:  "Allow roles to grant any scope.",
+			},
+		},
+		HelpSynopsis:    `Policy of the scopes roles can grant.`,
+		HelpDescription: `Restricts the scopes of roles and static roles, which can't exceed the allowed scopes. The policy is also enforced when access tokens are issued.`,
+	}
+}
+
+type scopePolicy struct {
+	AllowedScopes []string `json:"allowed_scopes,omitempty"`
+	VerifyGroups  bool     `json:"verify_groups,omitempty"`
+}
+
+// fetchScopePolicy returns an empty policy if there's no configuration
+func (b *backend) fetchScopePolicy(ctx context.Context, storage logical.Storage) (*scopePolicy, error) {
+	var policy scopePolicy
+
+	entry, err := storage.Get(ctx, scopePolicyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return &policy, nil
+	}
+
+	if err := entry.DecodeJSON(&policy); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+func (b *backend) pathConfigScopePolicyUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	policy, err := b.fetchScopePolicy(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if val, ok := data.GetOk("allowed_scopes"); ok {
+		policy.AllowedScopes = val.([]string)
+	}
+
+	if val, ok := data.GetOk("verify_groups"); ok {
+		policy.VerifyGroups = val.(bool)
+	}
+
+	entry, err := logical.StorageEntryJSON(scopePolicyPath, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathConfigScopePolicyRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	policy, err := b.fetchScopePolicy(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"allowed_scopes": policy.AllowedScopes,
+			"verify_groups":  policy.VerifyGroups,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigScopePolicyDelete(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	if err := req.Storage.Delete(ctx, scopePolicyPath); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// allows returns an error for the first element of the scope the policy doesn't allow.
+// Templated elements are allowed, the policy is enforced again once they are evaluated.
+func (p scopePolicy) allows(elements []scopeElement) error {
+	if len(p.AllowedScopes) == 0 {
+		return nil
+	}
+
+	for _, element := range elements {
+		if element.Templated {
+			continue
+		}
+
+		if !strutil.StrListContainsGlob(p.AllowedScopes, element.Element) {
+			return fmt.Errorf("scope %q is not allowed by the scope policy", element.Element)
+		}
+	}
+
+	return nil
+}
+
+// validateScope validates the grammar of the scope, and that the scope policy allows it.
+// Callers must hold the configMutex.
+func (b *backend) validateScope(ctx context.Context, storage logical.Storage, config adminConfiguration, scope string) (*logical.Response, error) {
+	elements, err := parseScope(scope)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	policy, err := b.fetchScopePolicy(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := policy.allows(elements); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if !policy.VerifyGroups {
+		return nil, nil
+	}
+
+	for _, element := range elements {
+		if len(element.Group) == 0 {
+			continue
+		}
+
+		exists, err := b.groupExists(ctx, config, element.Group)
+		if err != nil {
+			return logical.ErrorResponse("error verifying group %q", element.Group), err
+		}
+
+		if !exists {
+			return logical.ErrorResponse("group %q does not exist", element.Group), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// enforceScopePolicy checks the scope of an access token is allowed by the scope policy, before it is issued.
+// Callers must hold the configMutex.
+func (b *backend) enforceScopePolicy(ctx context.Context, storage logical.Storage, scope string) (*logical.Response, error) {
+	policy, err := b.fetchScopePolicy(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(policy.AllowedScopes) == 0 {
+		return nil, nil
+	}
+
+	elements, err := parseScope(scope)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := policy.allows(elements); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return nil, nil
+}
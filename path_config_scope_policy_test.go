@@ -0,0 +1,196 @@
+package artifactory
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackend_RoleScopeGrammar(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests("")
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username": "test-username",
+			"scope":    "applied-permissions/group:readers",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `invalid scope "applied-permissions/group:readers"`)
+}
+
+func TestBackend_ScopePolicy(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/scope_policy",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"allowed_scopes": "applied-permissions/groups:team-*,applied-permissions/user",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/scope_policy",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"applied-permissions/groups:team-*", "applied-permissions/user"}, resp.Data["allowed_scopes"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username": "test-username",
+			"scope":    "applied-permissions/groups:team-a,team-b",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"scope": "applied-permissions/groups:team-a,admins",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `scope "applied-permissions/groups:admins" is not allowed by the scope policy`)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/test-static-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":        "test-username",
+			"scope":           "applied-permissions/admin",
+			"rotation_period": 3600,
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `scope "applied-permissions/admin" is not allowed by the scope policy`)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp.Secret)
+
+	// A tightened policy applies to the existing roles
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/scope_policy",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"allowed_scopes": "applied-permissions/user",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "is not allowed by the scope policy")
+}
+
+func TestBackend_ScopePolicyVerifyGroups(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v2/groups/readers",
+		httpmock.NewStringResponder(200, `{"name": "readers"}`))
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v2/groups/raeders",
+		httpmock.NewStringResponder(404, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/scope_policy",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"verify_groups": true,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username": "test-username",
+			"scope":    "applied-permissions/groups:readers",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"scope": "applied-permissions/groups:readers,raeders",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `group "raeders" does not exist`)
+}
@@ -2,11 +2,26 @@ package artifactory
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/jarcoal/httpmock"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -121,9 +136,8 @@ func (e *accTestEnv) PathConfigUpdateErrors(t *testing.T) {
 		"access_token": "test-access-token",
 		"url":          e.URL,
 	})
-	assert.NotNil(t, resp)
-	assert.True(t, resp.IsError())
-	assert.Contains(t, resp.Error().Error(), "Unable to get Artifactory Version")
+	assert.Nil(t, resp)
+	assert.ErrorContains(t, err, "Unable to get Artifactory Version")
 	assert.ErrorContains(t, err, "could not get the system version")
 }
 
@@ -214,3 +228,251 @@ func TestBackend_AccessTokenAsSHA256(t *testing.T) {
 	assert.NotNil(t, resp)
 	assert.EqualValues(t, correctSHA256, resp.Data["access_token_sha256"])
 }
+
+// testCertificate generates a certificate signed by parent (self-signed when parent is nil) and returns it with its PEM encodings
+func testCertificate(t *testing.T, template *x509.Certificate, parent *tls.Certificate) (tls.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	parentCert, parentKey := template, interface{}(key)
+	if parent != nil {
+		parentCert = parent.Leaf
+		parentKey = parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	assert.NoError(t, err)
+	cert.Leaf, err = x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return cert, certPEM, keyPEM
+}
+
+// newMutualTLSServer starts a fake Artifactory requiring client certificates signed by the returned CA
+func newMutualTLSServer(t *testing.T) (*httptest.Server, string, string, string) {
+	ca, caPEM, _ := testCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil)
+
+	serverCert, _, _ := testCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+
+	_, clientPEM, clientKeyPEM := testCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "vault"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Leaf)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/artifactory/api/system/version" {
+			_, _ = w.Write([]byte(artVersion))
+		}
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+
+	return server, caPEM, clientPEM, clientKeyPEM
+}
+
+func TestBackend_CACertAndClientCertificate(t *testing.T) {
+	server, caPEM, clientPEM, clientKeyPEM := newMutualTLSServer(t)
+	defer server.Close()
+
+	b, config := makeBackend(t)
+
+	// Without the CA bundle the server certificate cannot be verified
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"access_token": "test-access-token",
+			"url":          server.URL,
+		},
+	})
+	assert.Nil(t, resp)
+	assert.ErrorContains(t, err, "Unable to get Artifactory Version")
+	assert.Equal(t, http.StatusBadGateway, err.(logical.HTTPCodedError).Code())
+
+	// Without the client certificate the server rejects the connection
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"access_token": "test-access-token",
+			"url":          server.URL,
+			"ca_cert":      caPEM,
+		},
+	})
+	assert.Nil(t, resp)
+	assert.ErrorContains(t, err, "Unable to get Artifactory Version")
+	assert.Equal(t, http.StatusServiceUnavailable, err.(logical.HTTPCodedError).Code())
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(caPath, []byte(caPEM), 0o600))
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"access_token": "test-access-token",
+			"url":          server.URL,
+			"ca_cert":      "",
+			"ca_path":      caPath,
+			"client_cert":  clientPEM,
+			"client_key":   clientKeyPEM,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.EqualValues(t, "7.19.10", resp.Data["version"])
+	assert.EqualValues(t, caPath, resp.Data["ca_path"])
+	assert.EqualValues(t, clientPEM, resp.Data["client_cert"])
+	assert.NotContains(t, resp.Data, "client_key")
+
+	// The transport is rebuilt from storage after invalidation
+	b.invalidate(context.Background(), "config/admin")
+	adminConfig, err := b.fetchAdminConfiguration(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+	assert.NoError(t, b.getVersion(context.Background(), *adminConfig))
+}
+
+func TestBackend_InvalidTLSConfiguration(t *testing.T) {
+	b, config := makeBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"access_token": "test-access-token",
+			"url":          "https://127.0.0.1",
+			"ca_cert":      "not a certificate",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "ca_cert")
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"access_token": "test-access-token",
+			"url":          "https://127.0.0.1",
+			"client_cert":  "not a certificate",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "client_cert and client_key must be set together")
+}
+
+func TestBackend_ConfigTimeouts(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests("")
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 10, resp.Data["connect_timeout"])
+	assert.EqualValues(t, 60, resp.Data["request_timeout"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"connect_timeout": "5s",
+			"request_timeout": "2m",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	adminConfig, err := b.fetchAdminConfiguration(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+
+	// The request timeout bounds each request with its retries, not each attempt
+	httpClient, err := b.getHttpClient(*adminConfig)
+	assert.NoError(t, err)
+	assert.Zero(t, httpClient.Timeout)
+
+	var clientConfig access.Config
+	b.newAccessClient = func(config access.Config) (access.AccessClient, error) {
+		clientConfig = config
+		return newAccessClient(config)
+	}
+	_, err = b.accessClientForVersion(*adminConfig, "7.55.6")
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, clientConfig.RequestTimeout)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, resp.Data["connect_timeout"])
+	assert.EqualValues(t, 120, resp.Data["request_timeout"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"request_timeout": -1},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+}
@@ -38,6 +38,22 @@ func (b *backend) pathConfigUserToken() *framework.Path {
 				Type:        framework.TypeString,
 				Description: `Optional. Default token description to set in Artifactory for issued user access tokens.`,
 			},
+			"project_key": {
+				Type:        framework.TypeString,
+				Description: `Optional. Key of the JFrog project issued user access tokens are scoped to by default. The project must exist.`,
+			},
+			"locked_fields": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Optional. Parameters of user_token/<user name> callers can't set, so that the configured defaults apply, such as 'refreshable,max_ttl'.`,
+			},
+			"allowed_usernames": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Optional. Glob patterns of the usernames user access tokens can be issued for, such as '*@example.com'. If unset, any username is allowed.`,
+			},
+			"entity_binding": {
+				Type:        framework.TypeString,
+				Description: `Optional. Vault identity template of the username of the caller, such as '{{identity.entity.aliases.<mount accessor>.name}}' or '{{identity.entity.metadata.<key>}}'. If set, user access tokens can only be issued for the username of the caller (compared case-insensitively), and user_token/self issues them.`,
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
@@ -50,7 +66,7 @@ func (b *backend) pathConfigUserToken() *framework.Path {
 			},
 		},
 		HelpSynopsis:    `Configuration for issuing user tokens.`,
-		HelpDescription: `Configures default values for the user_token/<user name> path.`,
+		HelpDescription: `Configures default values and restrictions for the user_token/<user name> and user_token/self paths.`,
 	}
 }
 
@@ -61,6 +77,10 @@ type userTokenConfiguration struct {
 	DefaultTTL            time.Duration `json:"default_ttl,omitempty"`
 	MaxTTL                time.Duration `json:"max_ttl,omitempty"`
 	DefaultDescription    string        `json:"default_description,omitempty"`
+	ProjectKey            string        `json:"project_key,omitempty"`
+	AllowedUsernames      []string      `json:"allowed_usernames,omitempty"`
+	EntityBinding         string        `json:"entity_binding,omitempty"`
+	LockedFields          []string      `json:"locked_fields,omitempty"`
 }
 
 // fetchAdminConfiguration will return nil,nil if there's no configuration
@@ -128,6 +148,52 @@ func (b *backend) pathConfigUserTokenUpdate(ctx context.Context, req *logical.Re
 		userTokenConfig.DefaultDescription = val.(string)
 	}
 
+	if val, ok := data.GetOk("project_key"); ok {
+		userTokenConfig.ProjectKey = val.(string)
+
+		if len(userTokenConfig.ProjectKey) > 0 {
+			if len(config.ArtifactoryURL) == 0 {
+				return logical.ErrorResponse("backend not configured"), nil
+			}
+
+			exists, err := b.projectExists(ctx, *config, userTokenConfig.ProjectKey)
+			if err != nil {
+				return logical.ErrorResponse("error verifying project %q", userTokenConfig.ProjectKey), err
+			}
+
+			if !exists {
+				return logical.ErrorResponse("project %q does not exist", userTokenConfig.ProjectKey), nil
+			}
+		}
+	}
+
+	if val, ok := data.GetOk("locked_fields"); ok {
+		lockedFields := val.([]string)
+		fields := userTokenFields()
+		for _, field := range lockedFields {
+			if _, ok := fields[field]; !ok {
+				return logical.ErrorResponse("unknown locked field %q", field), nil
+			}
+		}
+		userTokenConfig.LockedFields = lockedFields
+	}
+
+	if val, ok := data.GetOk("allowed_usernames"); ok {
+		userTokenConfig.AllowedUsernames = val.([]string)
+	}
+
+	if val, ok := data.GetOk("entity_binding"); ok {
+		userTokenConfig.EntityBinding = val.(string)
+
+		if len(userTokenConfig.EntityBinding) > 0 && !usesIdentityTemplate(userTokenConfig.EntityBinding) {
+			return logical.ErrorResponse("entity_binding must be an identity template"), nil
+		}
+
+		if err := validateIdentityTemplate("entity_binding", userTokenConfig.EntityBinding); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
 	entry, err := logical.StorageEntryJSON("config/user_token", userTokenConfig)
 	if err != nil {
 		return nil, err
@@ -168,10 +234,14 @@ func (b *backend) pathConfigUserTokenRead(ctx context.Context, req *logical.Requ
 		"default_ttl":             userTokenConfig.DefaultTTL.Seconds(),
 		"max_ttl":                 userTokenConfig.MaxTTL.Seconds(),
 		"default_description":     userTokenConfig.DefaultDescription,
+		"project_key":             userTokenConfig.ProjectKey,
+		"allowed_usernames":       userTokenConfig.AllowedUsernames,
+		"entity_binding":          userTokenConfig.EntityBinding,
+		"locked_fields":           userTokenConfig.LockedFields,
 	}
 
 	// Optionally include token info if it parses properly
-	token, err := b.getTokenInfo(*config, config.AccessToken)
+	token, err := b.getTokenInfo(ctx, *config, config.AccessToken)
 	if err != nil {
 		b.Logger().Warn("Error parsing AccessToken: " + err.Error())
 	} else {
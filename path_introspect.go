@@ -0,0 +1,197 @@
+package artifactory
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+)
+
+func (b *backend) pathIntrospect() *framework.Path {
+	return &framework.Path{
+		Pattern: "introspect",
+		Fields: map[string]*framework.FieldSchema{
+			"token": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: `The access token or reference token to introspect.`,
+			},
+			"connection": {
+				Type:        framework.TypeString,
+				Description: `Optional. The name of the Artifactory connection (config/connections/<name>) the token is from. Defaults to the connection configured at config/admin.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathIntrospectPerform,
+				Summary:  "Describe an Artifactory access token.",
+			},
+		},
+		HelpSynopsis: `Describe an Artifactory access token or reference token.`,
+		HelpDescription: `
+Returns the decoded claims of an access token and whether its signature verifies against the
+Artifactory root certificate, whether Artifactory still lists the token, and which Vault role or
+path issued it, if it was issued by this backend.
+`,
+	}
+}
+
+func (b *backend) pathIntrospectPerform(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	connection := data.Get("connection").(string)
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return notConfiguredResponse(connection), nil
+	}
+
+	go b.sendUsage(*config, "pathIntrospectPerform")
+
+	token := data.Get("token").(string)
+	if len(token) == 0 {
+		return logical.ErrorResponse("missing token"), nil
+	}
+
+	resp := &logical.Response{Data: map[string]interface{}{}}
+
+	var tokenID string
+
+	if strings.Count(token, ".") == 2 {
+		claims, verified, err := b.introspectJWT(ctx, *config, token, resp)
+		if err != nil {
+			return logical.ErrorResponse("token is neither a valid access token nor a reference token: %s", err), nil
+		}
+
+		tokenID, _ = claims["jti"].(string)
+
+		resp.Data["token_type"] = "access_token"
+		resp.Data["claims"] = map[string]interface{}(claims)
+		resp.Data["signature_verified"] = verified
+		resp.Data["token_id"] = tokenID
+		resp.Data["scope"], _ = claims["scp"].(string)
+		resp.Data["username"] = usernameFromSubject(claims)
+
+		if expires := b.tokenExpiration(claims); expires > 0 {
+			resp.Data["expires"] = expires
+			resp.Data["expired"] = time.Now().Unix() >= expires
+		}
+	} else {
+		// A reference token can't be decoded, Artifactory tells what it's an alias of
+		resp.Data["token_type"] = "reference_token"
+
+		info, err := b.getOwnTokenInfo(ctx, *config, token)
+		switch {
+		case errors.Is(err, access.ErrIncompatibleVersion):
+			resp.AddWarning("reference tokens can't be introspected with this Artifactory version")
+		case err != nil:
+			resp.AddWarning("could not get the reference token from Artifactory: " + err.Error())
+		case info == nil:
+			resp.Data["active"] = false
+		default:
+			tokenID = info.TokenID
+			resp.Data["token_id"] = info.TokenID
+			resp.Data["username"] = usernameFromSubject(jwt.MapClaims{"sub": info.Subject})
+			if info.Expiry > 0 {
+				resp.Data["expires"] = info.Expiry
+				resp.Data["expired"] = time.Now().Unix() >= info.Expiry
+			}
+		}
+	}
+
+	if len(tokenID) == 0 {
+		return resp, nil
+	}
+
+	if _, known := resp.Data["active"]; !known {
+		info, err := b.getTokenByID(ctx, *config, tokenID)
+		switch {
+		case errors.Is(err, access.ErrIncompatibleVersion):
+			resp.AddWarning("whether the token is active can't be checked with this Artifactory version")
+		case err != nil:
+			resp.AddWarning("could not check whether the token is active: " + err.Error())
+		default:
+			resp.Data["active"] = info != nil
+		}
+	}
+
+	issued, err := b.fetchIssuedToken(ctx, req.Storage, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Data["issued_by_vault"] = issued != nil
+	if issued != nil {
+		resp.Data["vault"] = issuedTokenToMap(*issued)
+	}
+
+	return resp, nil
+}
+
+// introspectJWT decodes the claims of the access token, verifying its signature if possible
+func (b *backend) introspectJWT(ctx context.Context, config adminConfiguration, token string, resp *logical.Response) (jwt.MapClaims, bool, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return nil, false, err
+	}
+
+	_, err := b.verifyJWT(ctx, config, token, jwt.WithoutClaimsValidation())
+	switch {
+	case errors.Is(err, access.ErrIncompatibleVersion):
+		resp.AddWarning("the signature can't be verified with this Artifactory version")
+		return claims, false, nil
+	case err != nil:
+		resp.AddWarning("signature verification failed: " + err.Error())
+		return claims, false, nil
+	}
+
+	return claims, true, nil
+}
+
+// usernameFromSubject returns the username of a subject such as jfac@01fr1x1h805xmg0t17xhqr1v7a/users/admin
+func usernameFromSubject(claims jwt.MapClaims) string {
+	sub, _ := claims["sub"].(string)
+
+	parts := strings.Split(sub, "/")
+	if len(parts) < 3 {
+		return ""
+	}
+
+	return strings.Join(parts[2:], "/")
+}
+
+func issuedTokenToMap(issued issuedToken) map[string]interface{} {
+	issuedMap := map[string]interface{}{
+		"issued_by": issued.IssuedBy,
+		"username":  issued.Username,
+		"issued_at": issued.IssuedAt.Format(time.RFC3339),
+	}
+
+	if len(issued.Role) > 0 {
+		issuedMap["role"] = issued.Role
+	}
+	if len(issued.Connection) > 0 {
+		issuedMap["connection"] = issued.Connection
+	}
+	if len(issued.DisplayName) > 0 {
+		issuedMap["display_name"] = issued.DisplayName
+	}
+	if len(issued.EntityID) > 0 {
+		issuedMap["entity_id"] = issued.EntityID
+	}
+	if len(issued.RequestPath) > 0 {
+		issuedMap["request_path"] = issued.RequestPath
+	}
+
+	return issuedMap
+}
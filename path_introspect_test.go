@@ -0,0 +1,213 @@
+package artifactory
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackend_IntrospectIssuedToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	signer := newTestTokenSigner(t)
+	accessToken := signer.accessToken(t, "issued-token-id", "test-username", "applied-permissions/user", time.Hour)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/cert/root",
+		httpmock.NewStringResponder(200, signer.rootCert))
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, signer.createTokenResponse(t, "issued-token-id", accessToken)))
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/tokens/issued-token-id",
+		httpmock.NewStringResponder(200, `{"token_id": "issued-token-id", "subject": "jfac@01h424hvwpytzk1azxh6k807e5/users/test-username"}`))
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/issued-token-id",
+		httpmock.NewStringResponder(200, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username": "test-username",
+			"scope":    "applied-permissions/user",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "token/test-role",
+		MountPoint:  "artifactory/",
+		DisplayName: "oidc-jdoe",
+		Storage:     config.StorageView,
+	})
+	assert.NoError(t, err)
+	secret := resp.Secret
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "introspect",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"token": accessToken},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	assert.Equal(t, "access_token", resp.Data["token_type"])
+	assert.Equal(t, "issued-token-id", resp.Data["token_id"])
+	assert.Equal(t, "test-username", resp.Data["username"])
+	assert.Equal(t, "applied-permissions/user", resp.Data["scope"])
+	assert.Equal(t, true, resp.Data["signature_verified"])
+	assert.Equal(t, false, resp.Data["expired"])
+	assert.Equal(t, true, resp.Data["active"])
+	assert.Equal(t, true, resp.Data["issued_by_vault"])
+
+	vault := resp.Data["vault"].(map[string]interface{})
+	assert.Equal(t, "role", vault["issued_by"])
+	assert.Equal(t, "test-role", vault["role"])
+	assert.Equal(t, "oidc-jdoe", vault["display_name"])
+	assert.Equal(t, "artifactory/token/test-role", vault["request_path"])
+
+	// Revoked tokens are removed from the index
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Secret:    secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	issued, err := b.fetchIssuedToken(context.Background(), config.StorageView, "issued-token-id")
+	assert.NoError(t, err)
+	assert.Nil(t, issued)
+}
+
+func TestBackend_IntrospectForeignToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	signer := newTestTokenSigner(t)
+	forger := newTestTokenSigner(t)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/cert/root",
+		httpmock.NewStringResponder(200, signer.rootCert))
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/tokens/forged-token-id",
+		httpmock.NewStringResponder(404, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "introspect",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"token": forger.accessToken(t, "forged-token-id", "admin", "applied-permissions/admin", 0),
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+	assert.Equal(t, false, resp.Data["signature_verified"])
+	assert.Nil(t, resp.Data["expires"])
+	assert.Equal(t, false, resp.Data["active"])
+	assert.Equal(t, false, resp.Data["issued_by_vault"])
+	assert.Equal(t, "admin", resp.Data["username"])
+	assert.NotEmpty(t, resp.Warnings)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "introspect",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"token": "not.a.jwt"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+}
+
+func TestBackend_IntrospectReferenceToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/tokens/me",
+		func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") != "Bearer cmVmdGtuOjAxOjE3MjA" {
+				return httpmock.NewStringResponse(401, ""), nil
+			}
+			return httpmock.NewStringResponse(200, `{
+				"token_id": "reference-token-id",
+				"subject": "jfac@01h424hvwpytzk1azxh6k807e5/users/jdoe",
+				"expiry": 4102444800
+			}`), nil
+		})
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/tokens/reference-token-id",
+		httpmock.NewStringResponder(200, `{"token_id": "reference-token-id"}`))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "introspect",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"token": "cmVmdGtuOjAxOjE3MjA"},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+	assert.Equal(t, "reference_token", resp.Data["token_type"])
+	assert.Equal(t, "reference-token-id", resp.Data["token_id"])
+	assert.Equal(t, "jdoe", resp.Data["username"])
+	assert.Equal(t, int64(4102444800), resp.Data["expires"])
+	assert.Equal(t, true, resp.Data["active"])
+	assert.Equal(t, false, resp.Data["issued_by_vault"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "introspect",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"token": "cmVmdGtuOnJldm9rZWQ"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, false, resp.Data["active"])
+	assert.Nil(t, resp.Data["token_id"])
+}
@@ -0,0 +1,304 @@
+package artifactory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	pendingRevocationsPrefix = "revocations/pending/"
+
+	revocationRetryInitialBackoff = time.Minute
+	revocationRetryMaxBackoff     = 6 * time.Hour
+)
+
+func (b *backend) pathListPendingRevocations() *framework.Path {
+	return &framework.Path{
+		Pattern: "revocations/pending/?$",
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathPendingRevocationList,
+			},
+		},
+		HelpSynopsis: `List access tokens whose revocation in Artifactory failed and is being retried.`,
+	}
+}
+
+func (b *backend) pathPendingRevocations() *framework.Path {
+	return &framework.Path{
+		Pattern: "revocations/pending/" + framework.GenericNameRegex("token_id"),
+		Fields: map[string]*framework.FieldSchema{
+			"token_id": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: `The id of the access token pending revocation.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathPendingRevocationRead,
+				Summary:  `Examine a pending revocation.`,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathPendingRevocationRetry,
+				Summary:  `Retry a pending revocation now.`,
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathPendingRevocationDelete,
+				Summary:  `Drop a pending revocation without revoking the access token.`,
+			},
+		},
+		HelpSynopsis: `Manage access tokens whose revocation in Artifactory failed.`,
+		HelpDescription: `
+When Artifactory can't be reached to revoke an access token at the end of its lease, the lease is still revoked
+in Vault and the access token is queued here. The backend retries the revocation periodically, with exponential
+backoff, until it succeeds.
+
+Writing to revocations/pending/<token_id> retries the revocation immediately. Deleting it drops the entry, leaving
+the access token in Artifactory.
+`,
+	}
+}
+
+// pendingRevocation is an access token which could not be revoked and is queued for retry.
+// Secret holds the InternalData of the revoked lease.
+type pendingRevocation struct {
+	Secret      map[string]interface{} `json:"secret"`
+	CreatedAt   time.Time              `json:"created_at"`
+	Attempts    int                    `json:"attempts"`
+	LastError   string                 `json:"last_error,omitempty"`
+	LastAttempt time.Time              `json:"last_attempt"`
+	NextAttempt time.Time              `json:"next_attempt"`
+}
+
+func (b *backend) pathPendingRevocationList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.revocationsMutex.Lock()
+	defer b.revocationsMutex.Unlock()
+
+	entries, err := req.Storage.List(ctx, pendingRevocationsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathPendingRevocationRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.revocationsMutex.Lock()
+	defer b.revocationsMutex.Unlock()
+
+	tokenID := data.Get("token_id").(string)
+
+	pending, err := b.fetchPendingRevocation(ctx, req.Storage, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	if pending == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: pendingRevocationToMap(tokenID, pending),
+	}, nil
+}
+
+func (b *backend) pathPendingRevocationRetry(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.RLock()
+	b.revocationsMutex.Lock()
+	defer b.revocationsMutex.Unlock()
+	defer b.configMutex.RUnlock()
+
+	tokenID := data.Get("token_id").(string)
+
+	pending, err := b.fetchPendingRevocation(ctx, req.Storage, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	if pending == nil {
+		return logical.ErrorResponse("no pending revocation for token %s", tokenID), nil
+	}
+
+	if err := b.retryPendingRevocation(ctx, req.Storage, tokenID, pending); err != nil {
+		return logical.ErrorResponse("error revoking access token %s: %s", tokenID, err), nil
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathPendingRevocationDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.revocationsMutex.Lock()
+	defer b.revocationsMutex.Unlock()
+
+	tokenID := data.Get("token_id").(string)
+
+	b.Logger().Warn("dropping pending revocation, the access token is left in Artifactory", "tokenId", tokenID)
+
+	if err := req.Storage.Delete(ctx, pendingRevocationsPrefix+tokenID); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func pendingRevocationToMap(tokenID string, pending *pendingRevocation) map[string]interface{} {
+	connection, _ := pending.Secret["connection"].(string)
+	username, _ := pending.Secret["username"].(string)
+	role, _ := pending.Secret["role"].(string)
+
+	pendingMap := map[string]interface{}{
+		"token_id":     tokenID,
+		"connection":   connection,
+		"username":     username,
+		"created_at":   pending.CreatedAt.Local(),
+		"attempts":     pending.Attempts,
+		"last_attempt": pending.LastAttempt.Local(),
+		"next_attempt": pending.NextAttempt.Local(),
+	}
+
+	if len(role) > 0 {
+		pendingMap["role"] = role
+	}
+	if len(pending.LastError) > 0 {
+		pendingMap["last_error"] = pending.LastError
+	}
+
+	return pendingMap
+}
+
+func (b *backend) fetchPendingRevocation(ctx context.Context, storage logical.Storage, tokenID string) (*pendingRevocation, error) {
+	entry, err := storage.Get(ctx, pendingRevocationsPrefix+tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	var pending pendingRevocation
+
+	if err := entry.DecodeJSON(&pending); err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
+
+func (b *backend) storePendingRevocation(ctx context.Context, storage logical.Storage, tokenID string, pending *pendingRevocation) error {
+	entry, err := logical.StorageEntryJSON(pendingRevocationsPrefix+tokenID, pending)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+// enqueueRevocation queues the access token of a lease for revocation after revoking it failed
+func (b *backend) enqueueRevocation(ctx context.Context, storage logical.Storage, secret map[string]interface{}, revokeErr error) error {
+	b.revocationsMutex.Lock()
+	defer b.revocationsMutex.Unlock()
+
+	tokenID, _ := secret["token_id"].(string)
+	if len(tokenID) == 0 {
+		return fmt.Errorf("missing token_id")
+	}
+
+	now := time.Now()
+	pending := &pendingRevocation{
+		Secret:      secret,
+		CreatedAt:   now,
+		Attempts:    1,
+		LastError:   revokeErr.Error(),
+		LastAttempt: now,
+		NextAttempt: now.Add(revocationRetryInitialBackoff),
+	}
+
+	return b.storePendingRevocation(ctx, storage, tokenID, pending)
+}
+
+// retryPendingRevocation attempts to revoke the access token again. The entry is removed on success,
+// otherwise the next attempt is scheduled with exponential backoff.
+func (b *backend) retryPendingRevocation(ctx context.Context, storage logical.Storage, tokenID string, pending *pendingRevocation) error {
+	connection, _ := pending.Secret["connection"].(string)
+
+	config, err := b.fetchConnectionConfiguration(ctx, storage, connection)
+	if err != nil {
+		return err
+	}
+
+	var revokeErr error
+	if config == nil {
+		revokeErr = fmt.Errorf("connection %q not configured", connection)
+	} else {
+		revokeErr = b.revokeSecret(ctx, *config, pending.Secret)
+	}
+
+	if revokeErr == nil {
+		b.Logger().Info("revoked pending access token", "tokenId", tokenID, "attempts", pending.Attempts+1)
+		b.unindexIssuedToken(ctx, storage, tokenID)
+		return storage.Delete(ctx, pendingRevocationsPrefix+tokenID)
+	}
+
+	now := time.Now()
+	pending.Attempts++
+	pending.LastError = revokeErr.Error()
+	pending.LastAttempt = now
+	pending.NextAttempt = now.Add(revocationBackoff(pending.Attempts))
+
+	if err := b.storePendingRevocation(ctx, storage, tokenID, pending); err != nil {
+		return err
+	}
+
+	return revokeErr
+}
+
+// revocationBackoff returns the delay before the next attempt, doubling with every failed attempt
+func revocationBackoff(attempts int) time.Duration {
+	backoff := revocationRetryInitialBackoff
+	for i := 1; i < attempts && backoff < revocationRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > revocationRetryMaxBackoff {
+		backoff = revocationRetryMaxBackoff
+	}
+
+	return backoff
+}
+
+// periodicRetryRevocations retries the pending revocations which are due
+func (b *backend) periodicRetryRevocations(ctx context.Context, storage logical.Storage) error {
+	b.configMutex.RLock()
+	b.revocationsMutex.Lock()
+	defer b.revocationsMutex.Unlock()
+	defer b.configMutex.RUnlock()
+
+	tokenIDs, err := storage.List(ctx, pendingRevocationsPrefix)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, tokenID := range tokenIDs {
+		pending, err := b.fetchPendingRevocation(ctx, storage, tokenID)
+		if err != nil {
+			return err
+		}
+
+		if pending == nil || now.Before(pending.NextAttempt) {
+			continue
+		}
+
+		// Failures are expected while Artifactory is unavailable, and are recorded on the entry
+		if err := b.retryPendingRevocation(ctx, storage, tokenID, pending); err != nil {
+			b.Logger().Warn("retrying revocation of access token failed", "tokenId", tokenID, "attempts", pending.Attempts, "err", err)
+		}
+	}
+
+	return nil
+}
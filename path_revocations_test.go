@@ -0,0 +1,180 @@
+package artifactory
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackend_RevokeFailureIsQueued(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	revokeURL := "http://myserver.com:80/access/api/v1/tokens/59e39159-19eb-463d-953d-1d6baf567db6"
+	httpmock.RegisterResponder(http.MethodDelete, revokeURL, httpmock.NewStringResponder(503, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	secret := &logical.Secret{
+		InternalData: map[string]interface{}{
+			"secret_type":  SecretArtifactoryAccessTokenType,
+			"role":         "test-role",
+			"access_token": "test-access-token",
+			"token_id":     "59e39159-19eb-463d-953d-1d6baf567db6",
+			"username":     "test-username",
+		},
+	}
+
+	// The lease is revoked in Vault even though Artifactory is unavailable
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Secret:    secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "revocations/pending/",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"59e39159-19eb-463d-953d-1d6baf567db6"}, resp.Data["keys"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "revocations/pending/59e39159-19eb-463d-953d-1d6baf567db6",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "test-role", resp.Data["role"])
+	assert.Equal(t, "test-username", resp.Data["username"])
+	assert.Equal(t, 1, resp.Data["attempts"])
+	assert.Contains(t, resp.Data["last_error"], "could not revoke tokenID")
+	assert.NotContains(t, resp.Data, "access_token")
+
+	// Not due yet, the revocation was attempted once with its retries
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 1+access.MaxRetries, httpmock.GetCallCountInfo()["DELETE "+revokeURL])
+
+	// Due, and still failing
+	pending, err := b.fetchPendingRevocation(context.Background(), config.StorageView, "59e39159-19eb-463d-953d-1d6baf567db6")
+	assert.NoError(t, err)
+	pending.NextAttempt = time.Now().Add(-time.Second)
+	assert.NoError(t, b.storePendingRevocation(context.Background(), config.StorageView, "59e39159-19eb-463d-953d-1d6baf567db6", pending))
+
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 2*(1+access.MaxRetries), httpmock.GetCallCountInfo()["DELETE "+revokeURL])
+
+	pending, err = b.fetchPendingRevocation(context.Background(), config.StorageView, "59e39159-19eb-463d-953d-1d6baf567db6")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pending.Attempts)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), pending.NextAttempt, 5*time.Second)
+
+	// Artifactory is back, force a retry
+	httpmock.RegisterResponder(http.MethodDelete, revokeURL, httpmock.NewStringResponder(200, ""))
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revocations/pending/59e39159-19eb-463d-953d-1d6baf567db6",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE "+revokeURL])
+
+	pending, err = b.fetchPendingRevocation(context.Background(), config.StorageView, "59e39159-19eb-463d-953d-1d6baf567db6")
+	assert.NoError(t, err)
+	assert.Nil(t, pending)
+}
+
+// An access token which Artifactory no longer has is revoked, so it isn't retried forever
+func TestBackend_PendingRevocationOfMissingToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	revokeURL := "http://myserver.com:80/access/api/v1/tokens/test-token-id"
+	httpmock.RegisterResponder(http.MethodDelete, revokeURL, httpmock.NewStringResponder(404, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	err := b.enqueueRevocation(context.Background(), config.StorageView, map[string]interface{}{
+		"access_token": "test-access-token",
+		"token_id":     "test-token-id",
+	}, assert.AnError)
+	assert.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revocations/pending/test-token-id",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE "+revokeURL])
+
+	pending, err := b.fetchPendingRevocation(context.Background(), config.StorageView, "test-token-id")
+	assert.NoError(t, err)
+	assert.Nil(t, pending)
+}
+
+func TestBackend_DropPendingRevocation(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	err := b.enqueueRevocation(context.Background(), config.StorageView, map[string]interface{}{
+		"access_token": "test-access-token",
+		"token_id":     "test-token-id",
+	}, assert.AnError)
+	assert.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "revocations/pending/test-token-id",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "revocations/pending/",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Data["keys"])
+}
+
+func TestRevocationBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, revocationBackoff(1))
+	assert.Equal(t, 2*time.Minute, revocationBackoff(2))
+	assert.Equal(t, 8*time.Minute, revocationBackoff(4))
+	assert.Equal(t, revocationRetryMaxBackoff, revocationBackoff(20))
+	assert.Equal(t, revocationRetryMaxBackoff, revocationBackoff(1000))
+}
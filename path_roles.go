@@ -8,6 +8,12 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+const (
+	expiryPolicyNever        = "never"
+	expiryPolicyMaxTTL       = "max_ttl"
+	expiryPolicyTTLPlusGrace = "ttl_plus_grace"
+)
+
 func (b *backend) pathListRoles() *framework.Path {
 	return &framework.Path{
 		Pattern: "roles/?$",
@@ -35,17 +41,17 @@ func (b *backend) pathRoles() *framework.Path {
 			},
 			"username": {
 				Type:        framework.TypeString,
-				Description: `Optional. Defaults to using the username_template. The static username for which the access token is created. If the user does not exist, Artifactory will create a transient user. Note that non-administrative access tokens can only create tokens for themselves.`,
+				Description: `Optional. Defaults to using the username_template. The static username for which the access token is created, which can use Vault identity templates such as {{identity.entity.aliases.<mount accessor>.name}}. If the user does not exist, Artifactory will create a transient user. Note that non-administrative access tokens can only create tokens for themselves.`,
 			},
 			"scope": {
 				Type:        framework.TypeString,
 				Required:    true,
-				Description: `Required. Space-delimited list. See the JFrog Artifactory REST documentation on "Create Token" for a full and up to date description.`,
+				Description: `Required, unless 'project_roles' are set without 'create_user'. Space-delimited list, which can use Vault identity templates such as {{identity.entity.metadata.<key>}}. See the JFrog Artifactory REST documentation on "Create Token" for a full and up to date description.`,
 			},
 			"refreshable": {
 				Type:        framework.TypeBool,
 				Default:     false,
-				Description: `Optional. Defaults to 'false'. A refreshable access token gets replaced by a new access token, which is not what a consumer of tokens from this backend would be expecting; instead they'd likely just request a new token periodically. Set this to 'true' only if your usage requires this. See the JFrog Artifactory documentation on "Generating Refreshable Tokens" (https://jfrog.com/help/r/jfrog-platform-administration-documentation/generating-refreshable-tokens) for a full and up to date description.`,
+				Description: `Optional. Defaults to 'false'. A refreshable access token gets replaced by a new access token, which is not what a consumer of tokens from this backend would be expecting; instead they'd likely just request a new token periodically. Set this to 'true' only if your usage requires this. With 'use_expiring_tokens', renewing the lease refreshes the access token. See the JFrog Artifactory documentation on "Generating Refreshable Tokens" (https://jfrog.com/help/r/jfrog-platform-administration-documentation/generating-refreshable-tokens) for a full and up to date description.`,
 			},
 			"audience": {
 				Type:        framework.TypeString,
@@ -56,6 +62,48 @@ func (b *backend) pathRoles() *framework.Path {
 				Default:     false,
 				Description: `Optional. Defaults to 'false'. Generate a Reference Token (alias to Access Token) in addition to the full token (available from Artifactory 7.38.10). A reference token is a shorter, 64-character string, which can be used as a bearer token, a password, or with the "X-JFrog-Art-Api" header. Note: Using the reference token might have performance implications over a full length token.`,
 			},
+			"connection": {
+				Type:        framework.TypeString,
+				Description: `Optional. The name of the Artifactory connection (config/connections/<name>) to issue tokens from. Defaults to the connection configured at config/admin.`,
+			},
+			"create_user": {
+				Type:        framework.TypeBool,
+				Default:     false,
+				Description: `Optional. Defaults to 'false'. Create an Artifactory user for each lease, named using the username_template, instead of a transient user. The user is a member of 'groups' and of the 'project_key' project, and is deleted when the lease is revoked. Requires Artifactory 7.49.3 or later.`,
+			},
+			"groups": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Optional. Groups the users created with 'create_user' are members of.`,
+			},
+			"project_key": {
+				Type:        framework.TypeString,
+				Description: `Optional. Key of the JFrog project access tokens are scoped to. The users created with 'create_user' are members of the project, with 'project_roles'. The project must exist.`,
+			},
+			"project_roles": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Optional. Roles in the 'project_key' project. Without 'create_user', access tokens get the scope 'applied-permissions/roles:<project_key>:<project_roles>', and 'scope' must not be set. With 'create_user', the roles of the created users in the project.`,
+			},
+			"permission_target": {
+				Type:        framework.TypeString,
+				Description: `Optional. JSON template of a permission target created for each lease and deleted when the lease is revoked, granting "actions" on "repositories" (with optional "include_patterns" and "exclude_patterns") to the user of the token and to optional "groups". The template can use {{.Username}}, {{.RoleName}} and {{.DisplayName}}. Requires 'create_user' or 'username'.`,
+			},
+			"docker_registries": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Optional. Docker registry hosts, with an optional port, the 'docker' and 'kubernetes' formats of access tokens authenticate to. Defaults to the host of the Artifactory URL.`,
+			},
+			"credential_templates": {
+				Type:        framework.TypeKVPairs,
+				Description: `Optional. Templates overriding the built-in ones of the 'npmrc', 'pip', 'maven', 'netrc' and 'gradle' formats of access tokens, by format. Templates are Go templates, which can use {{.Username}}, {{.Token}} (the reference token if there is one, the access token otherwise), {{.AccessToken}}, {{.ReferenceToken}}, {{.Repository}}, {{.ArtifactoryURL}}, {{.Host}}, {{.Hostname}}, {{.RepositoryURL "<package type>"}} and {{.AuthenticatedRepositoryURL "<package type>"}}.`,
+			},
+			"expiry_policy": {
+				Type:          framework.TypeString,
+				Description:   `Optional. How the expiry of access tokens in Artifactory is set: 'never' (no expiry), 'max_ttl' (the lease max_ttl) or 'ttl_plus_grace' (the lease ttl plus expiry_grace). Expiring access tokens require Artifactory 7.50.3 or later. Defaults to 'max_ttl' if use_expiring_tokens is set on the connection, 'never' otherwise.`,
+				AllowedValues: []interface{}{expiryPolicyNever, expiryPolicyMaxTTL, expiryPolicyTTLPlusGrace},
+			},
+			"expiry_grace": {
+				Type:        framework.TypeDurationSecond,
+				Description: `Optional. Time added to the lease ttl for the expiry of access tokens, with expiry_policy 'ttl_plus_grace'. Defaults to 0.`,
+			},
 			"default_ttl": {
 				Type:        framework.TypeDurationSecond,
 				Description: `Default TTL for issued access tokens. If unset, uses the backend's default_ttl. Cannot exceed max_ttl.`,
@@ -89,15 +137,28 @@ func (b *backend) pathRoles() *framework.Path {
 }
 
 type artifactoryRole struct {
-	GrantType             string        `json:"grant_type,omitempty"`
-	Username              string        `json:"username,omitempty"`
-	Scope                 string        `json:"scope"`
-	Refreshable           bool          `json:"refreshable"`
-	Audience              string        `json:"audience,omitempty"`
-	Description           string        `json:"description,omitempty"`
-	IncludeReferenceToken bool          `json:"include_reference_token"`
-	DefaultTTL            time.Duration `json:"default_ttl,omitempty"`
-	MaxTTL                time.Duration `json:"max_ttl,omitempty"`
+	GrantType             string            `json:"grant_type,omitempty"`
+	Username              string            `json:"username,omitempty"`
+	Scope                 string            `json:"scope"`
+	Refreshable           bool              `json:"refreshable"`
+	Audience              string            `json:"audience,omitempty"`
+	Description           string            `json:"description,omitempty"`
+	IncludeReferenceToken bool              `json:"include_reference_token"`
+	DefaultTTL            time.Duration     `json:"default_ttl,omitempty"`
+	MaxTTL                time.Duration     `json:"max_ttl,omitempty"`
+	Connection            string            `json:"connection,omitempty"`
+	ExpiryPolicy          string            `json:"expiry_policy,omitempty"`
+	ExpiryGrace           time.Duration     `json:"expiry_grace,omitempty"`
+	CreateUser            bool              `json:"create_user,omitempty"`
+	Groups                []string          `json:"groups,omitempty"`
+	ProjectKey            string            `json:"project_key,omitempty"`
+	ProjectRoles          []string          `json:"project_roles,omitempty"`
+	PermissionTarget      string            `json:"permission_target,omitempty"`
+	DockerRegistries      []string          `json:"docker_registries,omitempty"`
+	CredentialTemplates   map[string]string `json:"credential_templates,omitempty"`
+
+	// name is not stored, it's set when the role is read, such as to label metrics
+	name string
 }
 
 func (b *backend) pathRoleList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
@@ -118,17 +179,6 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, data
 	defer b.configMutex.RUnlock()
 	defer b.rolesMutex.Unlock()
 
-	config, err := b.fetchAdminConfiguration(ctx, req.Storage)
-	if err != nil {
-		return nil, err
-	}
-
-	if config == nil {
-		return logical.ErrorResponse("backend not configured"), nil
-	}
-
-	go b.sendUsage(*config, "pathRoleWrite")
-
 	roleName := data.Get("role").(string)
 
 	if roleName == "" {
@@ -149,6 +199,21 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, data
 		}
 	}
 
+	if value, ok := data.GetOk("connection"); ok {
+		role.Connection = value.(string)
+	}
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return notConfiguredResponse(role.Connection), nil
+	}
+
+	go b.sendUsage(*config, "pathRoleWrite")
+
 	if value, ok := data.GetOk("grant_type"); ok {
 		role.GrantType = value.(string)
 	}
@@ -182,10 +247,92 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, data
 		role.MaxTTL = time.Duration(value.(int)) * time.Second
 	}
 
-	if role.Scope == "" {
+	if value, ok := data.GetOk("expiry_policy"); ok {
+		role.ExpiryPolicy = value.(string)
+	}
+
+	if value, ok := data.GetOk("create_user"); ok {
+		role.CreateUser = value.(bool)
+	}
+
+	if value, ok := data.GetOk("groups"); ok {
+		role.Groups = value.([]string)
+	}
+
+	if value, ok := data.GetOk("project_key"); ok {
+		role.ProjectKey = value.(string)
+	}
+
+	if value, ok := data.GetOk("project_roles"); ok {
+		role.ProjectRoles = value.([]string)
+	}
+
+	if value, ok := data.GetOk("permission_target"); ok {
+		role.PermissionTarget = value.(string)
+	}
+
+	if value, ok := data.GetOk("docker_registries"); ok {
+		role.DockerRegistries = value.([]string)
+	}
+
+	if value, ok := data.GetOk("credential_templates"); ok {
+		role.CredentialTemplates = value.(map[string]string)
+	}
+
+	if value, ok := data.GetOk("expiry_grace"); ok {
+		role.ExpiryGrace = time.Duration(value.(int)) * time.Second
+	}
+
+	if role.Scope == "" && (role.CreateUser || len(role.ProjectRoles) == 0) {
 		return logical.ErrorResponse("missing scope"), nil
 	}
 
+	if err := validateIdentityTemplates(*role); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	resp, err := b.validateScope(ctx, req.Storage, *config, tokenScope(*role))
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	if resp := b.validateExpiryPolicy(ctx, *config, *role); resp != nil {
+		return resp, nil
+	}
+
+	if resp := b.validateUserCreation(ctx, *config, *role); resp != nil {
+		return resp, nil
+	}
+
+	resp, err = b.validateProject(ctx, *config, *role)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	if len(role.PermissionTarget) > 0 {
+		_, err := renderPermissionTarget(role.PermissionTarget, PermissionTargetMetadata{
+			Username:    "test-username",
+			RoleName:    roleName,
+			DisplayName: "test-display-name",
+		})
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		// Generated usernames don't exist in Artifactory, so permissions can't be granted to them
+		if !role.CreateUser && len(role.Username) == 0 {
+			return logical.ErrorResponse("permission_target requires create_user or a username"), nil
+		}
+	}
+
+	if err := validateDockerRegistries(role.DockerRegistries); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := validateCredentialTemplates(role.CredentialTemplates); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	entry, err := logical.StorageEntryJSON("roles/"+roleName, role)
 	if err != nil {
 		return nil, err
@@ -204,17 +351,6 @@ func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, data *
 	defer b.configMutex.RUnlock()
 	defer b.rolesMutex.RUnlock()
 
-	config, err := b.fetchAdminConfiguration(ctx, req.Storage)
-	if err != nil {
-		return nil, err
-	}
-
-	if config == nil {
-		return logical.ErrorResponse("backend not configured"), nil
-	}
-
-	go b.sendUsage(*config, "pathRoleRead")
-
 	roleName := data.Get("role").(string)
 
 	if roleName == "" {
@@ -226,6 +362,22 @@ func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, data *
 		return nil, err
 	}
 
+	connection := ""
+	if role != nil {
+		connection = role.Connection
+	}
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return notConfiguredResponse(connection), nil
+	}
+
+	go b.sendUsage(*config, "pathRoleRead")
+
 	if role == nil {
 		return nil, nil
 	}
@@ -251,6 +403,8 @@ func (b *backend) Role(ctx context.Context, storage logical.Storage, roleName st
 	if err := entry.DecodeJSON(&role); err != nil {
 		return nil, err
 	}
+	role.name = roleName
+
 	return &role, nil
 }
 
@@ -274,28 +428,164 @@ func (b *backend) roleToMap(roleName string, role artifactoryRole) (roleMap map[
 	if len(role.Audience) > 0 {
 		roleMap["audience"] = role.Audience
 	}
+	if len(role.Connection) > 0 {
+		roleMap["connection"] = role.Connection
+	}
+	if len(role.ExpiryPolicy) > 0 {
+		roleMap["expiry_policy"] = role.ExpiryPolicy
+		roleMap["expiry_grace"] = role.ExpiryGrace.Seconds()
+	}
+	if role.CreateUser {
+		roleMap["create_user"] = role.CreateUser
+		roleMap["groups"] = role.Groups
+	}
+	if len(role.ProjectKey) > 0 {
+		roleMap["project_key"] = role.ProjectKey
+		roleMap["project_roles"] = role.ProjectRoles
+	}
+	if len(role.PermissionTarget) > 0 {
+		roleMap["permission_target"] = role.PermissionTarget
+	}
+	if len(role.DockerRegistries) > 0 {
+		roleMap["docker_registries"] = role.DockerRegistries
+	}
+	if len(role.CredentialTemplates) > 0 {
+		roleMap["credential_templates"] = role.CredentialTemplates
+	}
 
 	return
 }
 
+func (b *backend) validateExpiryPolicy(ctx context.Context, config adminConfiguration, role artifactoryRole) *logical.Response {
+	switch role.ExpiryPolicy {
+	case "", expiryPolicyNever:
+	case expiryPolicyMaxTTL, expiryPolicyTTLPlusGrace:
+		if !b.supportForceRevocable(ctx, config) {
+			return logical.ErrorResponse("expiry_policy %q requires Artifactory 7.50.3 or later", role.ExpiryPolicy)
+		}
+	default:
+		return logical.ErrorResponse("invalid expiry_policy %q, must be one of %q, %q or %q", role.ExpiryPolicy, expiryPolicyNever, expiryPolicyMaxTTL, expiryPolicyTTLPlusGrace)
+	}
+
+	if role.ExpiryGrace < 0 {
+		return logical.ErrorResponse("expiry_grace must not be negative")
+	}
+
+	return nil
+}
+
+func (b *backend) validateUserCreation(ctx context.Context, config adminConfiguration, role artifactoryRole) *logical.Response {
+	if !role.CreateUser {
+		if len(role.Groups) > 0 {
+			return logical.ErrorResponse("groups require create_user")
+		}
+		return nil
+	}
+
+	if len(role.Username) > 0 {
+		return logical.ErrorResponse("username must not be set with create_user, usernames are generated with the username_template")
+	}
+
+	if len(role.ProjectKey) > 0 && len(role.ProjectRoles) == 0 {
+		return logical.ErrorResponse("project_roles are required with project_key and create_user")
+	}
+
+	if !b.supportAccessUsersAPI(ctx, config) {
+		return logical.ErrorResponse("create_user requires Artifactory 7.49.3 or later")
+	}
+
+	return nil
+}
+
+func (b *backend) validateProject(ctx context.Context, config adminConfiguration, role artifactoryRole) (*logical.Response, error) {
+	if len(role.ProjectRoles) > 0 {
+		if len(role.ProjectKey) == 0 {
+			return logical.ErrorResponse("project_key is required with project_roles"), nil
+		}
+
+		if !role.CreateUser && len(role.Scope) > 0 {
+			return logical.ErrorResponse("scope must not be set with project_roles, unless create_user is set"), nil
+		}
+	}
+
+	if len(role.ProjectKey) == 0 {
+		return nil, nil
+	}
+
+	exists, err := b.projectExists(ctx, config, role.ProjectKey)
+	if err != nil {
+		return logical.ErrorResponse("error verifying project %q", role.ProjectKey), err
+	}
+
+	if !exists {
+		return logical.ErrorResponse("project %q does not exist", role.ProjectKey), nil
+	}
+
+	return nil, nil
+}
+
+// tokenScope returns the scope of access tokens of the role
+func tokenScope(role artifactoryRole) string {
+	if len(role.Scope) == 0 && len(role.ProjectRoles) > 0 {
+		return projectRolesScope(role.ProjectKey, role.ProjectRoles)
+	}
+	return role.Scope
+}
+
+// tokenExpiresIn returns the expiry in Artifactory for access tokens of the role, 0 for no expiry.
+// role.DefaultTTL is expected to hold the ttl of the lease.
+func (b *backend) tokenExpiresIn(ctx context.Context, config adminConfiguration, role artifactoryRole) time.Duration {
+	switch role.ExpiryPolicy {
+	case expiryPolicyNever:
+		return 0
+	case expiryPolicyMaxTTL:
+		if !b.supportForceRevocable(ctx, config) {
+			return 0
+		}
+		return role.MaxTTL
+	case expiryPolicyTTLPlusGrace:
+		if !b.supportForceRevocable(ctx, config) || role.DefaultTTL == 0 {
+			return 0
+		}
+		return role.DefaultTTL + role.ExpiryGrace
+	default:
+		if !b.usesExpiringTokens(ctx, config) {
+			return 0
+		}
+		return role.MaxTTL
+	}
+}
+
 func (b *backend) pathRoleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	b.rolesMutex.Lock()
 	b.configMutex.RLock()
 	defer b.configMutex.RUnlock()
 	defer b.rolesMutex.Unlock()
 
-	config, err := b.fetchAdminConfiguration(ctx, req.Storage)
+	roleName := data.Get("role").(string)
+
+	role, err := b.Role(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	connection := ""
+	if role != nil {
+		connection = role.Connection
+	}
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
 
 	if config == nil {
-		return logical.ErrorResponse("backend not configured"), nil
+		return notConfiguredResponse(connection), nil
 	}
 
 	go b.sendUsage(*config, "pathRoleDelete")
 
-	err = req.Storage.Delete(ctx, "roles/"+data.Get("role").(string))
+	err = req.Storage.Delete(ctx, "roles/"+roleName)
 	if err != nil {
 		return nil, err
 	}
@@ -2,11 +2,14 @@ package artifactory
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/jarcoal/httpmock"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,7 +52,7 @@ func TestBackend_PathRoleList_CannotAddRoleWhenNotConfigured(t *testing.T) {
 
 	roleData := map[string]interface{}{
 		"username": "test-username",
-		"scope":    "test-scope",
+		"scope":    "applied-permissions/groups:test-group",
 	}
 
 	resp, err := b.HandleRequest(context.Background(), &logical.Request{
@@ -80,7 +83,7 @@ func TestBackend_PathRoleList_AddRole(t *testing.T) {
 	roleData := map[string]interface{}{
 		"role":     "test-role",
 		"username": "test-username",
-		"scope":    "test-scope",
+		"scope":    "applied-permissions/groups:test-group",
 	}
 
 	resp, err := b.HandleRequest(context.Background(), &logical.Request{
@@ -109,7 +112,7 @@ func TestBackend_PathRoleListReturnsRole(t *testing.T) {
 	roleData := map[string]interface{}{
 		"role":     "test-role",
 		"username": "test-username",
-		"scope":    "test-scope",
+		"scope":    "applied-permissions/groups:test-group",
 	}
 
 	_, err := b.HandleRequest(context.Background(), &logical.Request{
@@ -149,7 +152,7 @@ func TestBackend_PathRoleWriteThenRead(t *testing.T) {
 	roleData := map[string]interface{}{
 		"role":                    "test-role",
 		"username":                "test-username",
-		"scope":                   "test-scope",
+		"scope":                   "applied-permissions/groups:test-group",
 		"audience":                "test-audience",
 		"refreshable":             true,
 		"include_reference_token": true,
@@ -174,10 +177,107 @@ func TestBackend_PathRoleWriteThenRead(t *testing.T) {
 	assert.NoError(t, err)
 
 	assert.EqualValues(t, "test-username", resp.Data["username"])
-	assert.EqualValues(t, "test-scope", resp.Data["scope"])
+	assert.EqualValues(t, "applied-permissions/groups:test-group", resp.Data["scope"])
 	assert.EqualValues(t, "test-audience", resp.Data["audience"])
 	assert.EqualValues(t, true, resp.Data["refreshable"])
 	assert.EqualValues(t, true, resp.Data["include_reference_token"])
 	assert.EqualValues(t, 30*time.Minute.Seconds(), resp.Data["default_ttl"])
 	assert.EqualValues(t, 45*time.Minute.Seconds(), resp.Data["max_ttl"])
 }
+
+// Project roles are turned into the scope of the token, which is scoped to the project
+func TestBackend_PathRoleWithProjectRoles(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/projects/proj",
+		httpmock.NewStringResponder(200, `{"project_key": "proj"}`))
+
+	var tokenRequest access.CreateTokenRequest
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&tokenRequest))
+			return httpmock.NewStringResponse(200, jwtAccessToken), nil
+		})
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":      "test-username",
+			"project_key":   "proj",
+			"project_roles": "Developer,Viewer",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+
+	assert.Equal(t, "applied-permissions/roles:proj:Developer,Viewer", tokenRequest.Scope)
+	assert.Equal(t, "proj", tokenRequest.ProjectKey)
+}
+
+func TestBackend_PathRoleWithUnknownProject(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/projects/nope",
+		httpmock.NewStringResponder(404, `{"errors": [{"code": "NOT_FOUND", "message": "Project not found"}]}`))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":    "test-username",
+			"scope":       "applied-permissions/user",
+			"project_key": "nope",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `project "nope" does not exist`)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":      "test-username",
+			"scope":         "applied-permissions/user",
+			"project_key":   "nope",
+			"project_roles": "Developer",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "scope must not be set with project_roles")
+}
@@ -0,0 +1,83 @@
+package artifactory
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathStaticCred() *framework.Path {
+	return &framework.Path{
+		Pattern: "static-cred/" + framework.GenericNameWithAtRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: `The name of the static role.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathStaticCredRead,
+				Summary:  `Read the current access token of the static role.`,
+			},
+		},
+		HelpSynopsis: `Read the current Artifactory access token of the specified static role.`,
+		HelpDescription: `
+Returns the current access token of the static role. The "ttl" is the number of seconds until the next rotation;
+the access token remains valid for the static role's "overlap_period" after that.
+`,
+	}
+}
+
+func (b *backend) pathStaticCredRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rolesMutex.RLock()
+	defer b.rolesMutex.RUnlock()
+
+	roleName := data.Get("role").(string)
+
+	role, err := b.StaticRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return logical.ErrorResponse("no such static role"), nil
+	}
+
+	cred, err := b.staticCredential(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if cred == nil || len(cred.AccessToken) == 0 {
+		return logical.ErrorResponse("static role has no access token yet"), nil
+	}
+
+	nextRotation := cred.LastRotation.Add(role.RotationPeriod)
+
+	ttl := time.Until(nextRotation)
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	credMap := map[string]interface{}{
+		"access_token":  cred.AccessToken,
+		"token_id":      cred.TokenID,
+		"username":      role.Username,
+		"scope":         role.Scope,
+		"last_rotation": cred.LastRotation.Local(),
+		"next_rotation": nextRotation.Local(),
+		"ttl":           int64(ttl.Seconds()),
+	}
+
+	if len(cred.ReferenceToken) > 0 {
+		credMap["reference_token"] = cred.ReferenceToken
+	}
+
+	return &logical.Response{
+		Data: credMap,
+	}, nil
+}
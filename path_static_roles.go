@@ -0,0 +1,586 @@
+package artifactory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	defaultStaticRoleDescription = "Static role access token for artifactory-secrets plugin in Vault"
+
+	// staticCredentialExpiryMargin is added to the lifetime of static role tokens when expiring tokens are used,
+	// so that a late periodic run doesn't leave consumers with an expired token
+	staticCredentialExpiryMargin = time.Hour
+)
+
+func (b *backend) pathListStaticRoles() *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/?$",
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathStaticRoleList,
+			},
+		},
+		HelpSynopsis: `List configured static roles with this backend.`,
+	}
+}
+
+func (b *backend) pathStaticRoles() *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/" + framework.GenericNameWithAtRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: `The name of the static role, must be conform to alphanumeric plus at, dash, and period.`,
+			},
+			"username": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: `Required. The Artifactory user (e.g. a service account) the access token is created for.`,
+			},
+			"scope": {
+				Type:        framework.TypeString,
+				Description: `Optional. Defaults to 'applied-permissions/user'. Space-delimited list. See the JFrog Artifactory REST documentation on "Create Token" for a full and up to date description.`,
+			},
+			"audience": {
+				Type:        framework.TypeString,
+				Description: `Optional. See the JFrog Artifactory REST documentation on "Create Token" for a full and up to date description.`,
+			},
+			"description": {
+				Type:        framework.TypeString,
+				Description: `Optional. Token description to set in Artifactory.`,
+			},
+			"include_reference_token": {
+				Type:        framework.TypeBool,
+				Default:     false,
+				Description: `Optional. Defaults to 'false'. Generate a Reference Token (alias to Access Token) in addition to the full token (available from Artifactory 7.38.10).`,
+			},
+			"rotation_period": {
+				Type:        framework.TypeDurationSecond,
+				Required:    true,
+				Description: `Required. How often a new access token is created for the user.`,
+			},
+			"overlap_period": {
+				Type:        framework.TypeDurationSecond,
+				Description: `Optional. How long the previous access token stays valid after a rotation, before it is revoked. Must be less than rotation_period. Defaults to 0 (revoked immediately).`,
+			},
+			"connection": {
+				Type:        framework.TypeString,
+				Description: `Optional. The name of the Artifactory connection (config/connections/<name>) to issue tokens from. Defaults to the connection configured at config/admin.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathStaticRoleRead,
+				Summary:  `Read information about the specified static role.`,
+			},
+			logical.CreateOperation: &framework.PathOperation{
+				Callback: b.pathStaticRoleWrite,
+				Summary:  `Write information about the specified static role.`,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathStaticRoleWrite,
+				Summary:  `Overwrite information about the specified static role.`,
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathStaticRoleDelete,
+				Summary:  `Delete the specified static role, revoking its access tokens.`,
+			},
+		},
+		ExistenceCheck: b.staticRoleExistenceCheck,
+		HelpSynopsis:   `Manage static roles, which rotate a long-lived access token for a fixed Artifactory user.`,
+		HelpDescription: `
+A static role manages the access token of a fixed Artifactory user, such as a CI service account. An access token is
+created when the role is written, and a new one is created every "rotation_period". The previous access token stays
+valid for "overlap_period" and is then revoked.
+
+The current access token can be read from static-cred/<role>. Deleting the static role revokes its access tokens.
+`,
+	}
+}
+
+type staticRole struct {
+	Username              string        `json:"username"`
+	Scope                 string        `json:"scope"`
+	Audience              string        `json:"audience,omitempty"`
+	Description           string        `json:"description,omitempty"`
+	IncludeReferenceToken bool          `json:"include_reference_token"`
+	RotationPeriod        time.Duration `json:"rotation_period"`
+	OverlapPeriod         time.Duration `json:"overlap_period,omitempty"`
+	Connection            string        `json:"connection,omitempty"`
+}
+
+// staticCredential is the access token state of a static role, stored at static-cred/<role>
+type staticCredential struct {
+	AccessToken    string    `json:"access_token"`
+	ReferenceToken string    `json:"reference_token,omitempty"`
+	TokenID        string    `json:"token_id"`
+	LastRotation   time.Time `json:"last_rotation"`
+
+	// The previous access token is revoked once PreviousExpiration has passed
+	PreviousAccessToken string    `json:"previous_access_token,omitempty"`
+	PreviousTokenID     string    `json:"previous_token_id,omitempty"`
+	PreviousExpiration  time.Time `json:"previous_expiration,omitempty"`
+}
+
+func (b *backend) pathStaticRoleList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.rolesMutex.RLock()
+	defer b.rolesMutex.RUnlock()
+
+	entries, err := req.Storage.List(ctx, "static-roles/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathStaticRoleWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rolesMutex.Lock()
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+	defer b.rolesMutex.Unlock()
+
+	roleName := data.Get("role").(string)
+
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	role, err := b.StaticRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	createOperation := role == nil
+	if createOperation {
+		role = &staticRole{}
+	}
+
+	if value, ok := data.GetOk("connection"); ok {
+		if !createOperation && value.(string) != role.Connection {
+			return logical.ErrorResponse("connection cannot be changed, delete and recreate the static role instead"), nil
+		}
+		role.Connection = value.(string)
+	}
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return notConfiguredResponse(role.Connection), nil
+	}
+
+	go b.sendUsage(*config, "pathStaticRoleWrite")
+
+	if value, ok := data.GetOk("username"); ok {
+		role.Username = value.(string)
+	}
+
+	if value, ok := data.GetOk("scope"); ok {
+		role.Scope = value.(string)
+	}
+
+	if value, ok := data.GetOk("audience"); ok {
+		role.Audience = value.(string)
+	}
+
+	if value, ok := data.GetOk("description"); ok {
+		role.Description = value.(string)
+	}
+
+	if value, ok := data.GetOk("include_reference_token"); ok {
+		role.IncludeReferenceToken = value.(bool)
+	}
+
+	if value, ok := data.GetOk("rotation_period"); ok {
+		role.RotationPeriod = time.Duration(value.(int)) * time.Second
+	}
+
+	if value, ok := data.GetOk("overlap_period"); ok {
+		role.OverlapPeriod = time.Duration(value.(int)) * time.Second
+	}
+
+	if role.Username == "" {
+		return logical.ErrorResponse("missing username"), nil
+	}
+
+	if role.Scope == "" {
+		role.Scope = "applied-permissions/user"
+	}
+
+	if usesIdentityTemplate(role.Scope) {
+		return logical.ErrorResponse("scope of static roles can't use identity templates"), nil
+	}
+
+	if resp, err := b.validateScope(ctx, req.Storage, *config, role.Scope); resp != nil || err != nil {
+		return resp, err
+	}
+
+	if role.RotationPeriod <= 0 {
+		return logical.ErrorResponse("rotation_period must be greater than 0"), nil
+	}
+
+	if role.OverlapPeriod < 0 || role.OverlapPeriod >= role.RotationPeriod {
+		return logical.ErrorResponse("overlap_period must be between 0 and rotation_period"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("static-roles/"+roleName, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	// Create the initial access token for a new static role
+	if createOperation {
+		cred := &staticCredential{}
+		if err := b.rotateStaticCredential(ctx, req.Storage, *config, roleName, *role, cred); err != nil {
+			return logical.ErrorResponse("error creating access token for static role"), err
+		}
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathStaticRoleRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rolesMutex.RLock()
+	defer b.rolesMutex.RUnlock()
+
+	roleName := data.Get("role").(string)
+
+	role, err := b.StaticRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return nil, nil
+	}
+
+	roleMap := map[string]interface{}{
+		"role":                    roleName,
+		"username":                role.Username,
+		"scope":                   role.Scope,
+		"include_reference_token": role.IncludeReferenceToken,
+		"rotation_period":         role.RotationPeriod.Seconds(),
+		"overlap_period":          role.OverlapPeriod.Seconds(),
+	}
+
+	// Optional Attributes
+	if len(role.Audience) > 0 {
+		roleMap["audience"] = role.Audience
+	}
+	if len(role.Description) > 0 {
+		roleMap["description"] = role.Description
+	}
+	if len(role.Connection) > 0 {
+		roleMap["connection"] = role.Connection
+	}
+
+	cred, err := b.staticCredential(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if cred != nil {
+		roleMap["last_rotation"] = cred.LastRotation.Local()
+		roleMap["next_rotation"] = cred.LastRotation.Add(role.RotationPeriod).Local()
+	}
+
+	return &logical.Response{
+		Data: roleMap,
+	}, nil
+}
+
+func (b *backend) pathStaticRoleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rolesMutex.Lock()
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+	defer b.rolesMutex.Unlock()
+
+	roleName := data.Get("role").(string)
+
+	role, err := b.StaticRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return nil, nil
+	}
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return notConfiguredResponse(role.Connection), nil
+	}
+
+	go b.sendUsage(*config, "pathStaticRoleDelete")
+
+	cred, err := b.staticCredential(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if cred != nil {
+		if len(cred.PreviousTokenID) > 0 {
+			if err := b.revokeAccessToken(ctx, *config, cred.PreviousAccessToken, cred.PreviousTokenID); err != nil {
+				return logical.ErrorResponse("error revoking previous access token %s", cred.PreviousTokenID), err
+			}
+			b.unindexIssuedToken(ctx, req.Storage, cred.PreviousTokenID)
+		}
+
+		if len(cred.TokenID) > 0 {
+			if err := b.revokeAccessToken(ctx, *config, cred.AccessToken, cred.TokenID); err != nil {
+				return logical.ErrorResponse("error revoking access token %s", cred.TokenID), err
+			}
+			b.unindexIssuedToken(ctx, req.Storage, cred.TokenID)
+		}
+
+		if err := req.Storage.Delete(ctx, "static-cred/"+roleName); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := req.Storage.Delete(ctx, "static-roles/"+roleName); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) staticRoleExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
+	role, err := b.StaticRole(ctx, req.Storage, data.Get("role").(string))
+	return role != nil, err
+}
+
+func (b *backend) StaticRole(ctx context.Context, storage logical.Storage, roleName string) (*staticRole, error) {
+	entry, err := storage.Get(ctx, "static-roles/"+roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	var role staticRole
+
+	if err := entry.DecodeJSON(&role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// staticCredential returns the stored access token state of the static role, or nil if there is none
+func (b *backend) staticCredential(ctx context.Context, storage logical.Storage, roleName string) (*staticCredential, error) {
+	entry, err := storage.Get(ctx, "static-cred/"+roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	var cred staticCredential
+
+	if err := entry.DecodeJSON(&cred); err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// rotateStaticCredential creates a new access token for the static role. The current access token becomes
+// the previous one, which is revoked right away unless the role has an overlap_period.
+func (b *backend) rotateStaticCredential(ctx context.Context, storage logical.Storage, config adminConfiguration, roleName string, role staticRole, cred *staticCredential) error {
+	description := role.Description
+	if description == "" {
+		description = b.tokenDescription(defaultStaticRoleDescription)
+	}
+
+	tokenRole := artifactoryRole{
+		GrantType:             "client_credentials",
+		Username:              role.Username,
+		Scope:                 role.Scope,
+		Audience:              role.Audience,
+		Description:           description,
+		IncludeReferenceToken: role.IncludeReferenceToken,
+		MaxTTL:                role.RotationPeriod + role.OverlapPeriod + staticCredentialExpiryMargin,
+		name:                  roleName,
+	}
+
+	resp, walID, err := b.createTokenWithWAL(ctx, storage, config, tokenRole)
+	if err != nil {
+		return err
+	}
+
+	err = b.indexIssuedToken(ctx, storage, resp.TokenID, issuedToken{
+		IssuedBy:   issuedByStaticRole,
+		Role:       roleName,
+		Connection: role.Connection,
+		Username:   role.Username,
+		IssuedAt:   time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("error indexing access token: %w", err)
+	}
+
+	// A previous token still in its overlap period is replaced, so it must be revoked now, or queued for
+	// revocation, before it is forgotten
+	if len(cred.PreviousTokenID) > 0 {
+		if err := b.revokePreviousStaticToken(ctx, storage, config, roleName, cred); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	cred.PreviousAccessToken = cred.AccessToken
+	cred.PreviousTokenID = cred.TokenID
+	cred.PreviousExpiration = now.Add(role.OverlapPeriod)
+	cred.AccessToken = resp.AccessToken
+	cred.ReferenceToken = resp.ReferenceToken
+	cred.TokenID = resp.TokenID
+	cred.LastRotation = now
+
+	entry, err := logical.StorageEntryJSON("static-cred/"+roleName, cred)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	if err := framework.DeleteWAL(ctx, storage, walID); err != nil {
+		return fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+
+	b.emitTokenIssued("static-roles", roleName)
+
+	if role.OverlapPeriod == 0 {
+		return b.expireStaticCredential(ctx, storage, config, roleName, cred)
+	}
+
+	return nil
+}
+
+// expireStaticCredential revokes the previous access token of the static role
+func (b *backend) expireStaticCredential(ctx context.Context, storage logical.Storage, config adminConfiguration, roleName string, cred *staticCredential) error {
+	if len(cred.PreviousTokenID) == 0 {
+		return nil
+	}
+
+	if err := b.revokePreviousStaticToken(ctx, storage, config, roleName, cred); err != nil {
+		return err
+	}
+
+	cred.PreviousAccessToken = ""
+	cred.PreviousTokenID = ""
+	cred.PreviousExpiration = time.Time{}
+
+	entry, err := logical.StorageEntryJSON("static-cred/"+roleName, cred)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+// revokePreviousStaticToken revokes the previous access token of the static role. A failed revocation is queued
+// for retry, so that the static credential can forget the access token either way.
+func (b *backend) revokePreviousStaticToken(ctx context.Context, storage logical.Storage, config adminConfiguration, roleName string, cred *staticCredential) error {
+	err := b.revokeAccessToken(ctx, config, cred.PreviousAccessToken, cred.PreviousTokenID)
+	if err == nil {
+		b.unindexIssuedToken(ctx, storage, cred.PreviousTokenID)
+		return nil
+	}
+
+	b.Logger().Warn("error revoking previous static role access token, queued for retry", "role", roleName, "tokenId", cred.PreviousTokenID, "err", err)
+
+	err = b.enqueueRevocation(ctx, storage, map[string]interface{}{
+		"access_token": cred.PreviousAccessToken,
+		"token_id":     cred.PreviousTokenID,
+		"connection":   config.name,
+	}, err)
+	if err != nil {
+		return fmt.Errorf("error queueing revocation of previous access token: %w", err)
+	}
+
+	return nil
+}
+
+// periodicRotateStaticRoles rotates the access tokens of static roles which are due, and revokes
+// previous access tokens at the end of their overlap period
+func (b *backend) periodicRotateStaticRoles(ctx context.Context, storage logical.Storage) error {
+	b.rolesMutex.Lock()
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+	defer b.rolesMutex.Unlock()
+
+	roleNames, err := storage.List(ctx, "static-roles/")
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, roleName := range roleNames {
+		if err := b.rotateStaticRoleIfDue(ctx, storage, roleName); err != nil {
+			errs = append(errs, fmt.Errorf("static role %q: %w", roleName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (b *backend) rotateStaticRoleIfDue(ctx context.Context, storage logical.Storage, roleName string) error {
+	role, err := b.StaticRole(ctx, storage, roleName)
+	if err != nil || role == nil {
+		return err
+	}
+
+	cred, err := b.staticCredential(ctx, storage, roleName)
+	if err != nil {
+		return err
+	}
+
+	if cred == nil {
+		cred = &staticCredential{}
+	}
+
+	config, err := b.fetchConnectionConfiguration(ctx, storage, role.Connection)
+	if err != nil {
+		return err
+	}
+
+	if config == nil {
+		return fmt.Errorf("connection %q not configured", role.Connection)
+	}
+
+	now := time.Now()
+
+	if !now.Before(cred.LastRotation.Add(role.RotationPeriod)) {
+		b.Logger().Info("rotating static role access token", "role", roleName)
+		return b.rotateStaticCredential(ctx, storage, *config, roleName, *role, cred)
+	}
+
+	if len(cred.PreviousTokenID) > 0 && !now.Before(cred.PreviousExpiration) {
+		return b.expireStaticCredential(ctx, storage, *config, roleName, cred)
+	}
+
+	return nil
+}
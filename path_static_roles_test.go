@@ -0,0 +1,274 @@
+package artifactory
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockStaticRoleTokenRequests answers each token creation with a new token, token-1, token-2, ...
+func mockStaticRoleTokenRequests(t *testing.T, signer *testTokenSigner) {
+	created := 0
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			created++
+			tokenID := fmt.Sprintf("token-%d", created)
+			accessToken := signer.accessToken(t, tokenID, "ci-service-account", "applied-permissions/user", time.Hour)
+			return httpmock.NewStringResponse(200, signer.createTokenResponse(t, tokenID, accessToken)), nil
+		})
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		`=~^http://myserver.com:80/access/api/v1/tokens/token-\d+`,
+		httpmock.NewStringResponder(200, ""))
+}
+
+func TestBackend_StaticRoleLifecycle(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	signer := newTestTokenSigner(t)
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+	mockStaticRoleTokenRequests(t, signer)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "static-roles/ci",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":        "ci-service-account",
+			"rotation_period": 24 * 60 * 60,
+			"overlap_period":  60 * 60,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "static-roles/",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ci"}, resp.Data["keys"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-roles/ci",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ci-service-account", resp.Data["username"])
+	assert.Equal(t, "applied-permissions/user", resp.Data["scope"])
+	assert.EqualValues(t, 24*time.Hour.Seconds(), resp.Data["rotation_period"])
+	assert.EqualValues(t, time.Hour.Seconds(), resp.Data["overlap_period"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-cred/ci",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", resp.Data["token_id"])
+	assert.Equal(t, "ci-service-account", resp.Data["username"])
+	assert.InDelta(t, 24*time.Hour.Seconds(), resp.Data["ttl"], 60)
+
+	// Not due yet
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+
+	// Due, the previous token is kept for the overlap period
+	cred, err := b.staticCredential(context.Background(), config.StorageView, "ci")
+	assert.NoError(t, err)
+	cred.LastRotation = time.Now().Add(-25 * time.Hour)
+	entry, err := logical.StorageEntryJSON("static-cred/ci", cred)
+	assert.NoError(t, err)
+	assert.NoError(t, config.StorageView.Put(context.Background(), entry))
+
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+	assert.Equal(t, 0, httpmock.GetCallCountInfo()["DELETE http://myserver.com:80/access/api/v1/tokens/token-1"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-cred/ci",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", resp.Data["token_id"])
+
+	// End of the overlap period, the previous token is revoked
+	cred, err = b.staticCredential(context.Background(), config.StorageView, "ci")
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", cred.PreviousTokenID)
+	cred.PreviousExpiration = time.Now().Add(-time.Minute)
+	entry, err = logical.StorageEntryJSON("static-cred/ci", cred)
+	assert.NoError(t, err)
+	assert.NoError(t, config.StorageView.Put(context.Background(), entry))
+
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE http://myserver.com:80/access/api/v1/tokens/token-1"])
+
+	cred, err = b.staticCredential(context.Background(), config.StorageView, "ci")
+	assert.NoError(t, err)
+	assert.Empty(t, cred.PreviousTokenID)
+
+	// Deleting the static role revokes the current token
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "static-roles/ci",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE http://myserver.com:80/access/api/v1/tokens/token-2"])
+
+	cred, err = b.staticCredential(context.Background(), config.StorageView, "ci")
+	assert.NoError(t, err)
+	assert.Nil(t, cred)
+}
+
+func TestBackend_StaticRoleValidation(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	for name, tc := range map[string]struct {
+		data     map[string]interface{}
+		expected string
+	}{
+		"missing username": {
+			data:     map[string]interface{}{"rotation_period": 3600},
+			expected: "missing username",
+		},
+		"missing rotation period": {
+			data:     map[string]interface{}{"username": "ci-service-account"},
+			expected: "rotation_period must be greater than 0",
+		},
+		"overlap too long": {
+			data:     map[string]interface{}{"username": "ci-service-account", "rotation_period": 3600, "overlap_period": 3600},
+			expected: "overlap_period must be between 0 and rotation_period",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "static-roles/ci",
+				Storage:   config.StorageView,
+				Data:      tc.data,
+			})
+			assert.NoError(t, err)
+			assert.True(t, resp.IsError())
+			assert.Contains(t, resp.Error().Error(), tc.expected)
+		})
+	}
+
+	assert.Equal(t, 0, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+}
+
+func TestBackend_StaticRoleQueuesFailedRevocationOfPreviousToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	signer := newTestTokenSigner(t)
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+	mockStaticRoleTokenRequests(t, signer)
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/token-1",
+		httpmock.NewStringResponder(400, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "static-roles/ci",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":        "ci-service-account",
+			"rotation_period": 24 * 60 * 60,
+			"overlap_period":  60 * 60,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Rotate twice within the overlap period, so that token-1 is replaced as the previous token
+	for _, tokenID := range []string{"token-2", "token-3"} {
+		cred, err := b.staticCredential(context.Background(), config.StorageView, "ci")
+		assert.NoError(t, err)
+		cred.LastRotation = time.Now().Add(-25 * time.Hour)
+		entry, err := logical.StorageEntryJSON("static-cred/ci", cred)
+		assert.NoError(t, err)
+		assert.NoError(t, config.StorageView.Put(context.Background(), entry))
+
+		err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+		assert.NoError(t, err)
+
+		cred, err = b.staticCredential(context.Background(), config.StorageView, "ci")
+		assert.NoError(t, err)
+		assert.Equal(t, tokenID, cred.TokenID)
+	}
+
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE http://myserver.com:80/access/api/v1/tokens/token-1"])
+
+	pending, err := b.fetchPendingRevocation(context.Background(), config.StorageView, "token-1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, pending) {
+		assert.Equal(t, 1, pending.Attempts)
+		assert.Equal(t, "token-1", pending.Secret["token_id"])
+	}
+
+	// A failed revocation at the end of the overlap period is queued as well
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/token-2",
+		httpmock.NewStringResponder(400, ""))
+
+	cred, err := b.staticCredential(context.Background(), config.StorageView, "ci")
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", cred.PreviousTokenID)
+	cred.PreviousExpiration = time.Now().Add(-time.Minute)
+	entry, err := logical.StorageEntryJSON("static-cred/ci", cred)
+	assert.NoError(t, err)
+	assert.NoError(t, config.StorageView.Put(context.Background(), entry))
+
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE http://myserver.com:80/access/api/v1/tokens/token-2"])
+
+	cred, err = b.staticCredential(context.Background(), config.StorageView, "ci")
+	assert.NoError(t, err)
+	assert.Empty(t, cred.PreviousTokenID)
+
+	pending, err = b.fetchPendingRevocation(context.Background(), config.StorageView, "token-2")
+	assert.NoError(t, err)
+	assert.NotNil(t, pending)
+}
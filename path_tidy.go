@@ -0,0 +1,336 @@
+package artifactory
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+)
+
+const (
+	// tidyDescriptionMarker ends the default description of every access token issued by the plugin,
+	// tokenDescription follows it with the mount
+	tidyDescriptionMarker = "artifactory-secrets plugin in Vault"
+
+	tidyStateInactive = "Inactive"
+	tidyStateRunning  = "Running"
+	tidyStateFinished = "Finished"
+	tidyStateError    = "Error"
+)
+
+func (b *backend) pathTidy() *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy$",
+		Fields: map[string]*framework.FieldSchema{
+			"connection": {
+				Type:        framework.TypeString,
+				Description: `Optional. The name of the Artifactory connection (config/connections/<name>) to tidy. Defaults to the connection configured at config/admin.`,
+			},
+			"dry_run": {
+				Type:        framework.TypeBool,
+				Description: `Optional. Defaults to 'false'. Only report the orphaned access tokens, without revoking them.`,
+			},
+			"safety_buffer": {
+				Type:        framework.TypeDurationSecond,
+				Default:     3600,
+				Description: `Optional. Defaults to '1h'. Access tokens issued more recently than this aren't considered orphaned, so that tokens being issued are left alone.`,
+			},
+			"description_marker": {
+				Type:        framework.TypeString,
+				Description: `Optional. Access tokens whose description contains this text are considered issued by this backend. Defaults to the text identifying this mount in the default descriptions of its access tokens.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathTidyWrite,
+				Summary:  "Revoke the access tokens issued by this backend which are no longer tracked.",
+			},
+		},
+		HelpSynopsis: `Revoke orphaned access tokens in Artifactory.`,
+		HelpDescription: `
+Lists the access tokens in Artifactory, and revokes those issued by this backend which it no longer tracks,
+such as access tokens whose revocation failed, or which were issued by a mount that was since deleted.
+
+Access tokens are considered issued by this backend if their description contains the description_marker,
+which defaults to the text identifying this mount, so that the access tokens of other mounts are left alone.
+Of these, the access tokens which aren't in the backend's index of issued tokens are orphaned. The admin
+tokens of the connections are never revoked.
+
+The operation runs in the background, its progress is reported at tidy-status.
+`,
+	}
+}
+
+func (b *backend) pathTidyStatus() *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy-status$",
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathTidyStatusRead,
+				Summary:  "Examine the status of the last tidy operation.",
+			},
+		},
+		HelpSynopsis: `Status of the last tidy operation.`,
+	}
+}
+
+type tidyParams struct {
+	Connection        string
+	DryRun            bool
+	SafetyBuffer      time.Duration
+	DescriptionMarker string
+}
+
+// tidyStatus is the progress of the last tidy operation, it isn't persisted
+type tidyStatus struct {
+	tidyParams
+	State            string
+	Error            string
+	TimeStarted      time.Time
+	TimeFinished     time.Time
+	TokensListed     int
+	OrphanedTokens   []string
+	TokensRevoked    int
+	RevocationErrors int
+}
+
+func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	params := tidyParams{
+		Connection:        data.Get("connection").(string),
+		DryRun:            data.Get("dry_run").(bool),
+		SafetyBuffer:      time.Duration(data.Get("safety_buffer").(int)) * time.Second,
+		DescriptionMarker: data.Get("description_marker").(string),
+	}
+
+	if len(params.DescriptionMarker) == 0 {
+		params.DescriptionMarker = b.tidyDescriptionMarker()
+	}
+
+	if params.SafetyBuffer < 0 {
+		return logical.ErrorResponse("safety_buffer must not be negative"), nil
+	}
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, params.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return notConfiguredResponse(params.Connection), nil
+	}
+
+	go b.sendUsage(*config, "pathTidyWrite")
+
+	if !b.useNewAccessAPI(ctx, *config) {
+		return logical.ErrorResponse("tidy requires Artifactory 7.21.1 or later, to list access tokens"), nil
+	}
+
+	b.tidyMutex.Lock()
+	defer b.tidyMutex.Unlock()
+
+	if b.tidyStatus != nil && b.tidyStatus.State == tidyStateRunning {
+		return logical.ErrorResponse("a tidy operation is already in progress"), nil
+	}
+
+	b.tidyStatus = &tidyStatus{
+		tidyParams:  params,
+		State:       tidyStateRunning,
+		TimeStarted: time.Now(),
+	}
+
+	// The tidy operation outlives the request
+	go b.tidy(context.Background(), req.Storage, *config, params)
+
+	resp := &logical.Response{}
+	resp.AddWarning("Tidy operation successfully started. Its progress is reported at tidy-status.")
+	return logical.RespondWithStatusCode(resp, req, http.StatusAccepted)
+}
+
+func (b *backend) tidy(ctx context.Context, storage logical.Storage, config adminConfiguration, params tidyParams) {
+	err := b.tidyTokens(ctx, storage, config, params)
+
+	b.tidyMutex.Lock()
+	defer b.tidyMutex.Unlock()
+
+	b.tidyStatus.TimeFinished = time.Now()
+	if err != nil {
+		b.Logger().Error("error tidying access tokens", "err", err)
+		b.tidyStatus.State = tidyStateError
+		b.tidyStatus.Error = err.Error()
+		return
+	}
+
+	b.tidyStatus.State = tidyStateFinished
+}
+
+// tidyTokens revokes the orphaned access tokens of the connection, recording its progress in the tidy status
+func (b *backend) tidyTokens(ctx context.Context, storage logical.Storage, config adminConfiguration, params tidyParams) error {
+	admin, err := b.getOwnTokenInfo(ctx, config, config.AccessToken)
+	if err != nil {
+		return fmt.Errorf("could not get the admin token: %w", err)
+	}
+	if admin == nil {
+		return fmt.Errorf("the admin token was rejected by Artifactory")
+	}
+
+	adminTokenIDs, err := b.adminTokenIDs(ctx, storage)
+	if err != nil {
+		return err
+	}
+	adminTokenIDs[admin.TokenID] = true
+
+	tokens, err := b.listTokens(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	b.updateTidyStatus(func(status *tidyStatus) { status.TokensListed = len(tokens) })
+
+	issuedBefore := time.Now().Add(-params.SafetyBuffer).Unix()
+
+	for _, token := range tokens {
+		if !params.issuedByBackend(token, adminTokenIDs) || token.IssuedAt > issuedBefore {
+			continue
+		}
+
+		issued, err := b.fetchIssuedToken(ctx, storage, token.TokenID)
+		if err != nil {
+			return err
+		}
+
+		if issued != nil {
+			continue
+		}
+
+		b.updateTidyStatus(func(status *tidyStatus) { status.OrphanedTokens = append(status.OrphanedTokens, token.TokenID) })
+
+		if params.DryRun {
+			b.Logger().Info("found orphaned access token", "tokenId", token.TokenID, "subject", token.Subject)
+			continue
+		}
+
+		if err := b.revokeAccessToken(ctx, config, "", token.TokenID); err != nil {
+			b.Logger().Warn("error revoking orphaned access token", "tokenId", token.TokenID, "err", err)
+			b.updateTidyStatus(func(status *tidyStatus) { status.RevocationErrors++ })
+			continue
+		}
+
+		b.Logger().Info("revoked orphaned access token", "tokenId", token.TokenID, "subject", token.Subject)
+		b.updateTidyStatus(func(status *tidyStatus) { status.TokensRevoked++ })
+	}
+
+	return nil
+}
+
+// issuedByBackend returns true if the description of the access token has the description marker.
+// The admin tokens of the connections are never considered.
+func (p tidyParams) issuedByBackend(token access.TokenInfo, adminTokenIDs map[string]bool) bool {
+	if adminTokenIDs[token.TokenID] {
+		return false
+	}
+
+	return len(p.DescriptionMarker) > 0 && strings.Contains(token.Description, p.DescriptionMarker)
+}
+
+// adminTokenIDs returns the IDs of the admin tokens of every configured connection, from their JWT claims or,
+// for admin tokens which aren't JWTs, as reported by Artifactory
+func (b *backend) adminTokenIDs(ctx context.Context, storage logical.Storage) (map[string]bool, error) {
+	names, err := storage.List(ctx, "config/connections/")
+	if err != nil {
+		return nil, err
+	}
+
+	tokenIDs := map[string]bool{}
+
+	for _, name := range append([]string{""}, names...) {
+		config, err := b.fetchConnectionConfiguration(ctx, storage, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if config == nil {
+			continue
+		}
+
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(config.AccessToken, claims); err == nil {
+			if tokenID, _ := claims["jti"].(string); len(tokenID) > 0 {
+				tokenIDs[tokenID] = true
+				continue
+			}
+		}
+
+		info, err := b.getOwnTokenInfo(ctx, *config, config.AccessToken)
+		if err != nil {
+			return nil, fmt.Errorf("could not get the admin token of connection %q: %w", name, err)
+		}
+		if info != nil {
+			tokenIDs[info.TokenID] = true
+		}
+	}
+
+	return tokenIDs, nil
+}
+
+// tokenDescription returns the default description of an access token, followed by the mount, so that tidy
+// tells the access tokens of the mount from those of other mounts
+func (b *backend) tokenDescription(description string) string {
+	if len(b.backendUUID) == 0 {
+		return description
+	}
+	return description + " mount " + b.backendUUID
+}
+
+// tidyDescriptionMarker returns the text identifying the mount in the default descriptions of its access tokens
+func (b *backend) tidyDescriptionMarker() string {
+	return b.tokenDescription(tidyDescriptionMarker)
+}
+
+func (b *backend) updateTidyStatus(update func(status *tidyStatus)) {
+	b.tidyMutex.Lock()
+	defer b.tidyMutex.Unlock()
+	update(b.tidyStatus)
+}
+
+func (b *backend) pathTidyStatusRead(_ context.Context, _ *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.tidyMutex.Lock()
+	defer b.tidyMutex.Unlock()
+
+	if b.tidyStatus == nil {
+		return &logical.Response{Data: map[string]interface{}{"state": tidyStateInactive}}, nil
+	}
+
+	status := b.tidyStatus
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"state":              status.State,
+			"connection":         status.Connection,
+			"dry_run":            status.DryRun,
+			"safety_buffer":      int64(status.SafetyBuffer.Seconds()),
+			"description_marker": status.DescriptionMarker,
+			"time_started":       status.TimeStarted.Format(time.RFC3339),
+			"tokens_listed":      status.TokensListed,
+			"orphaned_tokens":    append([]string{}, status.OrphanedTokens...),
+			"tokens_revoked":     status.TokensRevoked,
+			"revocation_errors":  status.RevocationErrors,
+		},
+	}
+
+	if !status.TimeFinished.IsZero() {
+		resp.Data["time_finished"] = status.TimeFinished.Format(time.RFC3339)
+	}
+	if len(status.Error) > 0 {
+		resp.Data["error"] = status.Error
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,175 @@
+package artifactory
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForTidy returns the tidy status once the tidy operation is no longer running
+func waitForTidy(t *testing.T, b *backend, storage logical.Storage) map[string]interface{} {
+	for i := 0; i < 500; i++ {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "tidy-status",
+			Storage:   storage,
+		})
+		assert.NoError(t, err)
+
+		if resp.Data["state"] != tidyStateRunning {
+			return resp.Data
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("tidy operation did not finish")
+	return nil
+}
+
+func TestBackend_Tidy(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	// The admin token of another connection to the same Artifactory
+	otherAdminToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"jti": "other-admin-token"}).SignedString([]byte("test-key"))
+	assert.NoError(t, err)
+	entry, err := logical.StorageEntryJSON("config/connections/other", adminConfiguration{AccessToken: otherAdminToken, ArtifactoryURL: "http://myserver.com:80"})
+	assert.NoError(t, err)
+	assert.NoError(t, config.StorageView.Put(context.Background(), entry))
+
+	old := time.Now().Add(-2 * time.Hour).Unix()
+	roleDescription := b.tokenDescription(defaultRoleTokenDescription)
+	adminDescription := b.tokenDescription(defaultAdminTokenDescription)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/tokens/me",
+		httpmock.NewStringResponder(200, `{"token_id": "admin-token", "subject": "jfac@01h424hvwpytzk1azxh6k807e5/users/admin"}`))
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, fmt.Sprintf(`{"tokens": [
+			{"token_id": "admin-token", "description": %[3]q, "issued_at": %[1]d},
+			{"token_id": "other-admin-token", "description": %[3]q, "issued_at": %[1]d},
+			{"token_id": "indexed-token", "description": %[2]q, "issued_at": %[1]d},
+			{"token_id": "orphaned-token", "description": %[2]q, "issued_at": %[1]d},
+			{"token_id": "orphaned-failing-token", "description": %[2]q, "issued_at": %[1]d},
+			{"token_id": "recent-token", "description": %[2]q, "issued_at": %[4]d},
+			{"token_id": "other-mount-token", "description": %[5]q, "issued_at": %[1]d},
+			{"token_id": "foreign-token", "description": "CI token", "issued_at": %[1]d}
+		]}`, old, roleDescription, adminDescription, time.Now().Unix(), defaultRoleTokenDescription+" mount other-backend-uuid")))
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/orphaned-token",
+		httpmock.NewStringResponder(200, ""))
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/orphaned-failing-token",
+		httpmock.NewStringResponder(500, ""))
+
+	err = b.indexIssuedToken(context.Background(), config.StorageView, "indexed-token", issuedToken{IssuedBy: issuedByRole, Role: "test-role"})
+	assert.NoError(t, err)
+
+	status := waitForTidy(t, b, config.StorageView)
+	assert.Equal(t, tidyStateInactive, status["state"])
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "tidy",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"dry_run": true},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.Data[logical.HTTPStatusCode])
+
+	status = waitForTidy(t, b, config.StorageView)
+	assert.Equal(t, tidyStateFinished, status["state"])
+	assert.Equal(t, true, status["dry_run"])
+	assert.Equal(t, 8, status["tokens_listed"])
+	assert.Equal(t, []string{"orphaned-token", "orphaned-failing-token"}, status["orphaned_tokens"])
+	assert.Equal(t, 0, status["tokens_revoked"])
+	assert.Equal(t, 0, httpmock.GetCallCountInfo()["DELETE http://myserver.com:80/access/api/v1/tokens/orphaned-token"])
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "tidy",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+
+	status = waitForTidy(t, b, config.StorageView)
+	assert.Equal(t, tidyStateFinished, status["state"])
+	assert.Equal(t, false, status["dry_run"])
+	assert.Equal(t, []string{"orphaned-token", "orphaned-failing-token"}, status["orphaned_tokens"])
+	assert.Equal(t, 1, status["tokens_revoked"])
+	assert.Equal(t, 1, status["revocation_errors"])
+	assert.NotEmpty(t, status["time_finished"])
+
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["DELETE http://myserver.com:80/access/api/v1/tokens/orphaned-token"])
+	assert.Equal(t, 1+access.MaxRetries, info["DELETE http://myserver.com:80/access/api/v1/tokens/orphaned-failing-token"])
+	assert.Equal(t, 0, info["DELETE http://myserver.com:80/access/api/v1/tokens/admin-token"])
+	assert.Equal(t, 0, info["DELETE http://myserver.com:80/access/api/v1/tokens/other-admin-token"])
+	assert.Equal(t, 0, info["DELETE http://myserver.com:80/access/api/v1/tokens/other-mount-token"])
+	assert.Equal(t, 0, info["DELETE http://myserver.com:80/access/api/v1/tokens/indexed-token"])
+	assert.Equal(t, 0, info["DELETE http://myserver.com:80/access/api/v1/tokens/recent-token"])
+	assert.Equal(t, 0, info["DELETE http://myserver.com:80/access/api/v1/tokens/foreign-token"])
+}
+
+func TestBackend_TidyAdminTokenRejected(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/tokens/me",
+		httpmock.NewStringResponder(401, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "tidy",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+
+	status := waitForTidy(t, b, config.StorageView)
+	assert.Equal(t, tidyStateError, status["state"])
+	assert.Equal(t, "the admin token was rejected by Artifactory", status["error"])
+	assert.Equal(t, 0, httpmock.GetCallCountInfo()["GET http://myserver.com:80/access/api/v1/tokens"])
+}
+
+func TestBackend_TidyDescriptionMarker(t *testing.T) {
+	b, _ := makeBackend(t)
+
+	marker := b.tidyDescriptionMarker()
+	assert.Equal(t, "artifactory-secrets plugin in Vault mount test-backend-uuid", marker)
+
+	for _, description := range []string{defaultRoleTokenDescription, defaultUserTokenDescription, defaultStaticRoleDescription, defaultAdminTokenDescription} {
+		assert.Contains(t, b.tokenDescription(description), marker)
+	}
+}
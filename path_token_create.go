@@ -2,12 +2,15 @@ package artifactory
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+const defaultRoleTokenDescription = "Dynamic role access token for artifactory-secrets plugin in Vault"
+
 func (b *backend) pathTokenCreate() *framework.Path {
 	return &framework.Path{
 		Pattern: "token/" + framework.GenericNameWithAtRegex("role"),
@@ -24,6 +27,14 @@ func (b *backend) pathTokenCreate() *framework.Path {
 				Type:        framework.TypeDurationSecond,
 				Description: `Override the maximum TTL for this access token. Cannot exceed smallest (system, backend) maximum TTL.`,
 			},
+			"format": {
+				Type:        framework.TypeString,
+				Description: `Optional. Also return the access token rendered in this format: 'docker' (a ~/.docker/config.json as 'docker_config'), 'kubernetes' (a kubernetes.io/dockerconfigjson secret manifest as 'image_pull_secret'), 'npmrc' (an .npmrc as 'npmrc'), 'pip' (a pip.conf as 'pip_conf'), 'maven' (a settings.xml as 'settings_xml'), 'netrc' (a .netrc as 'netrc') or 'gradle' (a gradle.properties as 'gradle_properties').`,
+			},
+			"repository": {
+				Type:        framework.TypeString,
+				Description: `Optional. Key of the repository the 'npmrc', 'pip', 'maven' and 'gradle' formats are rendered for.`,
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.ReadOperation: &framework.PathOperation{
@@ -37,42 +48,18 @@ Create an Artifactory access token using paramters from the specified role.
 An optional 'ttl' parameter will override the role's 'default_ttl' parameter.
 
 An optional 'max_ttl' parameter will override the role's 'max_ttl' parameter.
+
+An optional 'format' parameter will also return the access token in a ready to use format.
 `,
 	}
 }
 
-type systemVersionResponse struct {
-	Version  string `json:"version"`
-	Revision string `json:"revision"`
-}
-
-type createTokenResponse struct {
-	TokenId        string `json:"token_id"`
-	AccessToken    string `json:"access_token"`
-	RefreshToken   string `json:"refresh_token"`
-	ExpiresIn      int    `json:"expires_in"`
-	Scope          string `json:"scope"`
-	TokenType      string `json:"token_type"`
-	ReferenceToken string `json:"reference_token"`
-}
-
 func (b *backend) pathTokenCreatePerform(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	b.rolesMutex.RLock()
 	b.configMutex.RLock()
 	defer b.configMutex.RUnlock()
 	defer b.rolesMutex.RUnlock()
 
-	config, err := b.fetchAdminConfiguration(ctx, req.Storage)
-	if err != nil {
-		return nil, err
-	}
-
-	if config == nil {
-		return logical.ErrorResponse("backend not configured"), nil
-	}
-
-	go b.sendUsage(*config, "pathTokenCreatePerform")
-
 	// Read in the requested role
 	roleName := data.Get("role").(string)
 
@@ -85,6 +72,23 @@ func (b *backend) pathTokenCreatePerform(ctx context.Context, req *logical.Reque
 		return logical.ErrorResponse("no such role"), nil
 	}
 
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return notConfiguredResponse(role.Connection), nil
+	}
+
+	go b.sendUsage(*config, "pathTokenCreatePerform")
+
+	// Evaluate identity templates in the username and scope, for the entity of the caller
+	templatedScope := usesIdentityTemplate(role.Scope)
+	if err := b.populateIdentityTemplates(req, role); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	// Define username for token by template if a static one is not set
 	if len(role.Username) == 0 {
 		role.Username, err = b.usernameProducer.Generate(UsernameMetadata{
@@ -96,6 +100,32 @@ func (b *backend) pathTokenCreatePerform(ctx context.Context, req *logical.Reque
 		}
 	}
 
+	role.Scope = tokenScope(*role)
+
+	// The scope is validated when the role is written, but an evaluated scope must still be well-formed,
+	// whether or not a scope policy is set. Scopes of roles written before scopes were validated are left alone.
+	if templatedScope {
+		if _, err := parseScope(role.Scope); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	if resp, err := b.enforceScopePolicy(ctx, req.Storage, role.Scope); resp != nil || err != nil {
+		return resp, err
+	}
+
+	format := data.Get("format").(string)
+	repository := data.Get("repository").(string)
+	if len(format) > 0 {
+		err := checkCredentialFormat(format, CredentialMetadata{
+			Repository: repository,
+			Templates:  role.CredentialTemplates,
+		})
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
 	var ttl time.Duration
 	if value, ok := data.GetOk("ttl"); ok {
 		ttl = time.Second * time.Duration(value.(int))
@@ -115,30 +145,114 @@ func (b *backend) pathTokenCreatePerform(ctx context.Context, req *logical.Reque
 		ttl = role.MaxTTL
 	}
 
-	resp, err := b.CreateToken(*config, *role)
+	// The expiry of the access token may follow the ttl of the lease
+	role.DefaultTTL = ttl
+	if role.DefaultTTL == 0 {
+		role.DefaultTTL = b.Backend.System().DefaultLeaseTTL()
+	}
+	expiresIn := b.tokenExpiresIn(ctx, *config, *role)
+
+	if role.Description == "" {
+		role.Description = b.tokenDescription(defaultRoleTokenDescription)
+	}
+
+	var walIDs []string
+
+	if role.CreateUser {
+		userWALID, err := b.createUserWithWAL(ctx, req.Storage, *config, *role)
+		if err != nil {
+			return nil, err
+		}
+		walIDs = append(walIDs, userWALID)
+	}
+
+	var permissionTargetName string
+
+	if len(role.PermissionTarget) > 0 {
+		var permissionTargetWALID string
+		permissionTargetName, permissionTargetWALID, err = b.createPermissionTargetWithWAL(ctx, req.Storage, *config, *role, PermissionTargetMetadata{
+			Username:    role.Username,
+			RoleName:    roleName,
+			DisplayName: req.DisplayName,
+		})
+		if err != nil {
+			return nil, err
+		}
+		walIDs = append(walIDs, permissionTargetWALID)
+	}
+
+	resp, walID, err := b.createTokenWithWAL(ctx, req.Storage, *config, *role)
 	if err != nil {
 		return nil, err
 	}
+	walIDs = append(walIDs, walID)
 
 	response := b.Secret(SecretArtifactoryAccessTokenType).Response(map[string]interface{}{
 		"access_token":    resp.AccessToken,
 		"refresh_token":   resp.RefreshToken,
 		"role":            roleName,
 		"scope":           resp.Scope,
-		"token_id":        resp.TokenId,
+		"token_id":        resp.TokenID,
 		"username":        role.Username,
 		"reference_token": resp.ReferenceToken,
+		"expires_in":      int64(expiresIn.Seconds()),
 	}, map[string]interface{}{
-		"role":            roleName,
-		"access_token":    resp.AccessToken,
-		"refresh_token":   resp.RefreshToken,
-		"token_id":        resp.TokenId,
-		"username":        role.Username,
-		"reference_token": resp.ReferenceToken,
+		"role":              roleName,
+		"connection":        role.Connection,
+		"access_token":      resp.AccessToken,
+		"refresh_token":     resp.RefreshToken,
+		"token_id":          resp.TokenID,
+		"username":          role.Username,
+		"reference_token":   resp.ReferenceToken,
+		"created_user":      role.CreateUser,
+		"permission_target": permissionTargetName,
 	})
 
+	if len(permissionTargetName) > 0 {
+		response.Data["permission_target"] = permissionTargetName
+	}
+
+	if len(format) > 0 {
+		rendered, err := renderCredentials(format, CredentialMetadata{
+			RoleName:       roleName,
+			Username:       role.Username,
+			AccessToken:    resp.AccessToken,
+			ReferenceToken: resp.ReferenceToken,
+			ArtifactoryURL: config.ArtifactoryURL,
+			Registries:     role.DockerRegistries,
+			Repository:     repository,
+			Templates:      role.CredentialTemplates,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error rendering format %q: %w", format, err)
+		}
+		for key, value := range rendered {
+			response.Data[key] = value
+		}
+	}
+
 	response.Secret.TTL = ttl
 	response.Secret.MaxTTL = role.MaxTTL
 
+	// The lease can't outlive the access token, unless the access token is refreshed on renewal
+	if expiresIn > 0 && !role.Refreshable && expiresIn < response.Secret.MaxTTL {
+		response.Secret.MaxTTL = expiresIn
+	}
+
+	if err := b.indexIssuedToken(ctx, req.Storage, resp.TokenID, newIssuedToken(req, issuedByRole, roleName, role.Connection, role.Username)); err != nil {
+		return nil, fmt.Errorf("error indexing access token: %w", err)
+	}
+
+	// The access token (and user, permission target) is tracked by the lease from here on. Failing the request
+	// now would leave anything whose WAL entry was already deleted untracked, so a failure is only logged:
+	// the entry is rolled back later, and revoking the lease then finds the rolled back resource already gone.
+	for _, walID := range walIDs {
+		if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+			b.Logger().Error("error deleting WAL entry of committed lease", "walId", walID, "err", err)
+		}
+	}
+
+	b.emitTokenIssued("token", roleName)
+
 	return response, nil
 }
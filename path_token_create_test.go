@@ -1,7 +1,18 @@
 package artifactory
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestAcceptanceBackend_PathTokenCreate(t *testing.T) {
@@ -20,3 +31,695 @@ func TestAcceptanceBackend_PathTokenCreate(t *testing.T) {
 	t.Run("delete role", accTestEnv.DeletePathRole)
 	t.Run("cleanup backend", accTestEnv.DeletePathConfig)
 }
+
+// mockUserRequests records the users created and deleted in Artifactory
+func mockUserRequests(t *testing.T, created, deleted *[]access.CreateUserRequest) {
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v2/users",
+		func(req *http.Request) (*http.Response, error) {
+			var user access.CreateUserRequest
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&user))
+			*created = append(*created, user)
+			return httpmock.NewStringResponse(201, ""), nil
+		})
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		`=~^http://myserver.com:80/access/api/v2/users/`,
+		func(req *http.Request) (*http.Response, error) {
+			username := strings.TrimPrefix(req.URL.Path, "/access/api/v2/users/")
+			*deleted = append(*deleted, access.CreateUserRequest{Username: username})
+			return httpmock.NewStringResponse(204, ""), nil
+		})
+}
+
+func TestBackend_CreateUserPerLease(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	var created, deleted []access.CreateUserRequest
+	mockUserRequests(t, &created, &deleted)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/projects/proj",
+		httpmock.NewStringResponder(200, `{"project_key": "proj"}`))
+
+	var member access.ProjectMember
+	httpmock.RegisterResponder(
+		http.MethodPut,
+		`=~^http://myserver.com:80/access/api/v1/projects/proj/users/`,
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&member))
+			return httpmock.NewStringResponse(200, ""), nil
+		})
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/59e39159-19eb-463d-953d-1d6baf567db6",
+		httpmock.NewStringResponder(200, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"scope":         "applied-permissions/user",
+			"create_user":   true,
+			"groups":        "readers,ci",
+			"project_key":   "proj",
+			"project_roles": "Developer",
+			"default_ttl":   5 * time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+
+	username := resp.Data["username"].(string)
+	assert.True(t, strings.HasPrefix(username, "v-test-role-"))
+	assert.Equal(t, true, resp.Secret.InternalData["created_user"])
+
+	if assert.Len(t, created, 1) {
+		assert.Equal(t, username, created[0].Username)
+		assert.Equal(t, []string{"readers", "ci"}, created[0].Groups)
+		assert.True(t, created[0].InternalPasswordDisabled)
+	}
+	assert.Equal(t, username, member.Name)
+	assert.Equal(t, []string{"Developer"}, member.Roles)
+
+	walIDs, err := framework.ListWAL(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+	assert.Empty(t, walIDs)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Secret:    resp.Secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, username, deleted[0].Username)
+	}
+}
+
+// A user created for a token which could not be created is deleted by the WAL rollback
+func TestBackend_CreateUserRolledBackOnTokenFailure(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	var created, deleted []access.CreateUserRequest
+	mockUserRequests(t, &created, &deleted)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(500, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"scope":       "applied-permissions/user",
+			"create_user": true,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.Error(t, err)
+	assert.Len(t, created, 1)
+	assert.Empty(t, deleted)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RollbackOperation,
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"immediate": true,
+		},
+	})
+	assert.NoError(t, err)
+
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, created[0].Username, deleted[0].Username)
+	}
+}
+
+func TestBackend_CreateUserRejected(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"scope":       "applied-permissions/user",
+			"create_user": true,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// A user which Artifactory refused to create isn't rolled back, as it may be an existing user,
+	// while a user whose creation failed on the server side may have been created
+	for statusCode, walEntries := range map[int]int{
+		http.StatusConflict:            0,
+		http.StatusInternalServerError: 1,
+	} {
+		httpmock.RegisterResponder(
+			http.MethodPost,
+			"http://myserver.com:80/access/api/v2/users",
+			httpmock.NewStringResponder(statusCode, ""))
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "token/test-role",
+			Storage:   config.StorageView,
+		})
+		assert.True(t, err != nil || resp.IsError(), statusCode)
+
+		walIDs, err := framework.ListWAL(context.Background(), config.StorageView)
+		assert.NoError(t, err)
+		assert.Len(t, walIDs, walEntries, statusCode)
+
+		for _, walID := range walIDs {
+			assert.NoError(t, framework.DeleteWAL(context.Background(), config.StorageView, walID))
+		}
+	}
+}
+
+func TestBackend_CreateUserRoleValidation(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	for name, tc := range map[string]struct {
+		data     map[string]interface{}
+		expected string
+	}{
+		"static username": {
+			data:     map[string]interface{}{"scope": "applied-permissions/user", "create_user": true, "username": "test-username"},
+			expected: "username must not be set with create_user",
+		},
+		"groups without create_user": {
+			data:     map[string]interface{}{"scope": "applied-permissions/user", "groups": "readers"},
+			expected: "groups require create_user",
+		},
+		"project without roles": {
+			data:     map[string]interface{}{"scope": "applied-permissions/user", "create_user": true, "project_key": "proj"},
+			expected: "project_roles are required with project_key",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "roles/test-role",
+				Storage:   config.StorageView,
+				Data:      tc.data,
+			})
+			assert.NoError(t, err)
+			assert.True(t, resp.IsError())
+			assert.Contains(t, resp.Error().Error(), tc.expected)
+		})
+	}
+}
+
+func TestBackend_PermissionTargetPerLease(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	var created access.PermissionTarget
+	var createdPath string
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		`=~^http://myserver.com:80/artifactory/api/v2/security/permissions/`,
+		func(req *http.Request) (*http.Response, error) {
+			createdPath = req.URL.Path
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&created))
+			return httpmock.NewStringResponse(201, ""), nil
+		})
+
+	var deletedPath string
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		`=~^http://myserver.com:80/artifactory/api/v2/security/permissions/`,
+		func(req *http.Request) (*http.Response, error) {
+			deletedPath = req.URL.Path
+			return httpmock.NewStringResponse(204, ""), nil
+		})
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/59e39159-19eb-463d-953d-1d6baf567db6",
+		httpmock.NewStringResponder(200, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username": "test-username",
+			"scope":    "applied-permissions/user",
+			"permission_target": `{
+				"repositories": ["generic-local"],
+				"include_patterns": ["jobs/{{.Username}}/**"],
+				"actions": ["read", "write"],
+				"groups": ["auditors"]
+			}`,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+
+	name := resp.Data["permission_target"].(string)
+	assert.True(t, strings.HasPrefix(name, "vault-test-role-"))
+	assert.Equal(t, name, resp.Secret.InternalData["permission_target"])
+	assert.Equal(t, "/artifactory/api/v2/security/permissions/"+name, createdPath)
+	assert.Equal(t, name, created.Name)
+	assert.Equal(t, []string{"generic-local"}, created.Repo.Repositories)
+	assert.Equal(t, []string{"jobs/test-username/**"}, created.Repo.IncludePatterns)
+	assert.Equal(t, []string{"read", "write"}, created.Repo.Actions.Users["test-username"])
+	assert.Equal(t, []string{"read", "write"}, created.Repo.Actions.Groups["auditors"])
+
+	walIDs, err := framework.ListWAL(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+	assert.Empty(t, walIDs)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Secret:    resp.Secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, "/artifactory/api/v2/security/permissions/"+name, deletedPath)
+}
+
+func TestBackend_PermissionTargetRoleValidation(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	for name, tc := range map[string]struct {
+		permissionTarget string
+		username         string
+		expected         string
+	}{
+		"generated username": {
+			permissionTarget: `{"repositories": ["generic-local"], "actions": ["read"]}`,
+			expected:         "permission_target requires create_user or a username",
+		},
+		"invalid template": {
+			permissionTarget: `{"repositories": ["{{.Username"]}`,
+			username:         "test-username",
+			expected:         "permission_target template initialization error",
+		},
+		"invalid JSON": {
+			permissionTarget: `{"repositories": "generic-local"}`,
+			username:         "test-username",
+			expected:         "permission_target is not valid JSON",
+		},
+		"no repositories": {
+			permissionTarget: `{"actions": ["read"]}`,
+			username:         "test-username",
+			expected:         "permission_target must have repositories",
+		},
+		"invalid action": {
+			permissionTarget: `{"repositories": ["generic-local"], "actions": ["reed"]}`,
+			username:         "test-username",
+			expected:         `permission_target action "reed" is not one of`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "roles/test-role",
+				Storage:   config.StorageView,
+				Data: map[string]interface{}{
+					"username":          tc.username,
+					"scope":             "applied-permissions/user",
+					"permission_target": tc.permissionTarget,
+				},
+			})
+			assert.NoError(t, err)
+			assert.True(t, resp.IsError())
+			assert.Contains(t, resp.Error().Error(), tc.expected)
+		})
+	}
+}
+
+func TestBackend_PathTokenCreateWithFormat(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":          "test-username",
+			"scope":             "applied-permissions/user",
+			"docker_registries": "docker.example.com,docker-remote.example.com:8443",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"format": "kubernetes"},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.NotNil(t, resp.Secret)
+
+	// The raw fields are still returned
+	assert.NotEmpty(t, resp.Data["access_token"])
+
+	var dockerConfig dockerConfig
+	assert.NoError(t, json.Unmarshal([]byte(resp.Data["docker_config"].(string)), &dockerConfig))
+	assert.Len(t, dockerConfig.Auths, 2)
+	assert.Equal(t, "test-username", dockerConfig.Auths["docker-remote.example.com:8443"].Username)
+	assert.Equal(t, resp.Data["access_token"], dockerConfig.Auths["docker.example.com"].Password)
+	assert.Contains(t, resp.Data["image_pull_secret"], `"type":"kubernetes.io/dockerconfigjson"`)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"format": "nope"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `unsupported format "nope"`)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"docker_registries": "https://docker.example.com/v2",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "invalid docker registry")
+}
+
+func TestBackend_PathTokenCreateWithCredentialTemplate(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username": "test-username",
+			"scope":    "applied-permissions/user",
+			"credential_templates": map[string]interface{}{
+				"gradle": "repoUser={{.Username}}\nrepoKey={{.Repository}}\n",
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"format": "gradle", "repository": "libs-release"},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, "repoUser=test-username\nrepoKey=libs-release\n", resp.Data["gradle_properties"])
+
+	// The repository is checked before the access token is created
+	httpmock.ZeroCallCounters()
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"format": "pip"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `format "pip" requires a repository`)
+	assert.Equal(t, 0, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"credential_templates": map[string]interface{}{"kubernetes": "{{.Token}}"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `format "kubernetes" can't be templated`)
+}
+
+// Roles written before scopes were validated still issue tokens, their scope is only checked by Artifactory
+func TestBackend_PathTokenCreateWithLegacyScope(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	var tokenRequest access.CreateTokenRequest
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&tokenRequest))
+			return httpmock.NewStringResponse(200, jwtAccessToken), nil
+		})
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	// As stored by earlier versions of the plugin, the scope is rejected when a role is written now
+	entry := &logical.StorageEntry{
+		Key:   "roles/legacy-role",
+		Value: []byte(`{"grant_type":"client_credentials","username":"test-username","scope":"api:* jfrt@*:admin","refreshable":false,"include_reference_token":false,"default_ttl":300000000000}`),
+	}
+	assert.NoError(t, config.StorageView.Put(context.Background(), entry))
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/legacy-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+	assert.Equal(t, "api:* jfrt@*:admin", tokenRequest.Scope)
+}
+
+func TestBackend_PathTokenCreateWithIdentityTemplates(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	var tokenRequest access.CreateTokenRequest
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			tokenRequest = access.CreateTokenRequest{}
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&tokenRequest))
+			return httpmock.NewStringResponse(200, jwtAccessToken), nil
+		})
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	config.System.(*logical.StaticSystemView).EntityVal = &logical.Entity{
+		ID:       "test-entity-id",
+		Name:     "jdoe",
+		Metadata: map[string]string{"artifactory_group": "dev"},
+		Aliases: []*logical.Alias{
+			{MountAccessor: "auth_oidc_1234", Name: "jdoe@example.com"},
+		},
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username": "{{identity.entity.aliases.auth_oidc_1234.name}}",
+			"scope":    "applied-permissions/groups:{{identity.entity.metadata.artifactory_group}},readers",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+		EntityID:  "test-entity-id",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, "jdoe@example.com", resp.Data["username"])
+	assert.Equal(t, "jdoe@example.com", tokenRequest.Username)
+	assert.Equal(t, "applied-permissions/groups:dev,readers", tokenRequest.Scope)
+
+	// Without an entity, no token is issued
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "the request has no identity entity")
+
+	// Values can't add scope elements or names
+	for _, value := range []string{"x applied-permissions/admin", "team,admins", `"dev"`, "roles:proj:admin"} {
+		config.System.(*logical.StaticSystemView).EntityVal.Metadata = map[string]string{"artifactory_group": value}
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "token/test-role",
+			Storage:   config.StorageView,
+			EntityID:  "test-entity-id",
+		})
+		assert.NoError(t, err)
+		if assert.True(t, resp.IsError(), value) {
+			assert.Contains(t, resp.Error().Error(), "must not contain whitespace")
+		}
+	}
+
+	// A missing value isn't replaced by an empty string
+	config.System.(*logical.StaticSystemView).EntityVal.Metadata = nil
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+		EntityID:  "test-entity-id",
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "error evaluating identity template in scope")
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username": "{{identity.entity.name",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "invalid identity template in username")
+}
@@ -2,44 +2,28 @@ package artifactory
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+const defaultUserTokenDescription = "User access token for artifactory-secrets plugin in Vault"
+
 func (b *backend) pathUserTokenCreate() *framework.Path {
+	fields := userTokenFields()
+	fields["username"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Required:    true,
+		Description: `The username of the user.`,
+	}
+
 	return &framework.Path{
 		Pattern: "user_token/" + framework.GenericNameWithAtRegex("username"),
-		Fields: map[string]*framework.FieldSchema{
-			"username": {
-				Type:        framework.TypeString,
-				Required:    true,
-				Description: `The username of the user.`,
-			},
-			"description": {
-				Type:        framework.TypeString,
-				Description: `Optional. Description for the user token.`,
-			},
-			"refreshable": {
-				Type:        framework.TypeBool,
-				Default:     false,
-				Description: `Optional. Defaults to 'false'.  A refreshable access token gets replaced by a new access token, which is not what a consumer of tokens from this backend would be expecting; instead they'd likely just request a new token periodically. Set this to 'true' only if your usage requires this. See the JFrog Artifactory documentation on "Generating Refreshable Tokens" (https://jfrog.com/help/r/jfrog-platform-administration-documentation/generating-refreshable-tokens) for a full and up to date description.`,
-			},
-			"include_reference_token": {
-				Type:        framework.TypeBool,
-				Default:     false,
-				Description: `Optional. Defaults to 'false'. Generate a Reference Token (alias to Access Token) in addition to the full token (available from Artifactory 7.38.10). A reference token is a shorter, 64-character string, which can be used as a bearer token, a password, or with the ״X-JFrog-Art-Api״ header. Note: Using the reference token might have performance implications over a full length token.`,
-			},
-			"max_ttl": {
-				Type:        framework.TypeDurationSecond,
-				Description: `Optional. Override the maximum TTL for this access token. Cannot exceed smallest (system, mount, backend) maximum TTL.`,
-			},
-			"ttl": {
-				Type:        framework.TypeDurationSecond,
-				Description: `Optional. Override the default TTL when issuing this access token. Cappaed at the smallest maximum TTL (system, mount, backend, request).`,
-			},
-		},
+		Fields:  fields,
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.ReadOperation: &framework.PathOperation{
 				Callback: b.pathUserTokenCreatePerform,
@@ -50,6 +34,54 @@ func (b *backend) pathUserTokenCreate() *framework.Path {
 	}
 }
 
+// pathUserTokenSelf must be registered before pathUserTokenCreate, which also matches user_token/self
+func (b *backend) pathUserTokenSelf() *framework.Path {
+	return &framework.Path{
+		Pattern: "user_token/self$",
+		Fields:  userTokenFields(),
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathUserTokenSelfPerform,
+			},
+		},
+		HelpSynopsis:    `Create an Artifactory access token for the caller.`,
+		HelpDescription: `Create an Artifactory access token for the username of the caller, evaluated from the entity_binding of config/user_token. Provides the same optional parameters as the user_token/<user name> path.`,
+	}
+}
+
+func userTokenFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"description": {
+			Type:        framework.TypeString,
+			Description: `Optional. Description for the user token.`,
+		},
+		"refreshable": {
+			Type:        framework.TypeBool,
+			Description: `Optional. Defaults to the refreshable of config/user_token, 'false' by default. A refreshable access token gets replaced by a new access token, which is not what a consumer of tokens from this backend would be expecting; instead they'd likely just request a new token periodically. Set this to 'true' only if your usage requires this. See the JFrog Artifactory documentation on "Generating Refreshable Tokens" (https://jfrog.com/help/r/jfrog-platform-administration-documentation/generating-refreshable-tokens) for a full and up to date description.`,
+		},
+		"include_reference_token": {
+			Type:        framework.TypeBool,
+			Description: `Optional. Defaults to the include_reference_token of config/user_token, 'false' by default. Generate a Reference Token (alias to Access Token) in addition to the full token (available from Artifactory 7.38.10). A reference token is a shorter, 64-character string, which can be used as a bearer token, a password, or with the ״X-JFrog-Art-Api״ header. Note: Using the reference token might have performance implications over a full length token.`,
+		},
+		"audience": {
+			Type:        framework.TypeString,
+			Description: `Optional. See the JFrog Artifactory REST documentation on "Create Token" for a full and up to date description. Defaults to the audience of config/user_token.`,
+		},
+		"project_key": {
+			Type:        framework.TypeString,
+			Description: `Optional. Key of the JFrog project the access token is scoped to. Defaults to the project_key of config/user_token.`,
+		},
+		"max_ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: `Optional. Override the maximum TTL for this access token. Cannot exceed smallest (system, mount, backend) maximum TTL.`,
+		},
+		"ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: `Optional. Override the default TTL when issuing this access token. Cappaed at the smallest maximum TTL (system, mount, backend, request).`,
+		},
+	}
+}
+
 func (b *backend) pathUserTokenCreatePerform(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	b.configMutex.RLock()
 	defer b.configMutex.RUnlock()
@@ -70,12 +102,85 @@ func (b *backend) pathUserTokenCreatePerform(ctx context.Context, req *logical.R
 		return nil, err
 	}
 
+	username := data.Get("username").(string)
+
+	if len(userTokenConfig.EntityBinding) > 0 {
+		callerUsername, err := b.callerUsername(req, *userTokenConfig)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		if !strings.EqualFold(username, callerUsername) {
+			return logical.ErrorResponse("username %q is not the username of the caller", username), nil
+		}
+	}
+
+	return b.createUserToken(ctx, req, data, *config, *userTokenConfig, username)
+}
+
+func (b *backend) pathUserTokenSelfPerform(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	config, err := b.fetchAdminConfiguration(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return logical.ErrorResponse("backend not configured"), nil
+	}
+
+	go b.sendUsage(*config, "pathUserTokenSelfPerform")
+
+	userTokenConfig, err := b.fetchUserTokenConfiguration(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(userTokenConfig.EntityBinding) == 0 {
+		return logical.ErrorResponse("entity_binding is not configured in config/user_token"), nil
+	}
+
+	username, err := b.callerUsername(req, *userTokenConfig)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return b.createUserToken(ctx, req, data, *config, *userTokenConfig, username)
+}
+
+// callerUsername returns the username of the caller, evaluated from the entity_binding
+func (b *backend) callerUsername(req *logical.Request, userTokenConfig userTokenConfiguration) (string, error) {
+	templater, err := b.identityTemplaterForRequest(req)
+	if err != nil {
+		return "", fmt.Errorf("entity_binding is configured, but %w", err)
+	}
+
+	return templater.populate("entity_binding", userTokenConfig.EntityBinding)
+}
+
+func (b *backend) createUserToken(ctx context.Context, req *logical.Request, data *framework.FieldData, config adminConfiguration, userTokenConfig userTokenConfiguration, username string) (*logical.Response, error) {
+	if len(userTokenConfig.AllowedUsernames) > 0 && !strutil.StrListContainsGlob(userTokenConfig.AllowedUsernames, username) {
+		return logical.ErrorResponse("username %q is not allowed", username), nil
+	}
+
+	for _, field := range userTokenConfig.LockedFields {
+		if _, ok := data.GetOk(field); ok {
+			return logical.ErrorResponse("%s is locked by config/user_token and can't be set", field), nil
+		}
+	}
+
 	role := artifactoryRole{
-		GrantType:   "client_credentials",
-		Username:    data.Get("username").(string),
-		Scope:       "applied-permissions/user",
-		MaxTTL:      b.Backend.System().MaxLeaseTTL(),
-		Description: userTokenConfig.DefaultDescription,
+		GrantType:             "client_credentials",
+		Username:              username,
+		Scope:                 "applied-permissions/user",
+		MaxTTL:                b.Backend.System().MaxLeaseTTL(),
+		Description:           userTokenConfig.DefaultDescription,
+		ProjectKey:            userTokenConfig.ProjectKey,
+		Audience:              userTokenConfig.Audience,
+		Refreshable:           userTokenConfig.Refreshable,
+		IncludeReferenceToken: userTokenConfig.IncludeReferenceToken,
 	}
 
 	if userTokenConfig.MaxTTL != 0 && userTokenConfig.MaxTTL < role.MaxTTL {
@@ -118,7 +223,15 @@ func (b *backend) pathUserTokenCreatePerform(ctx context.Context, req *logical.R
 		role.Description = value.(string)
 	}
 
-	resp, err := b.CreateToken(*config, role)
+	if role.Description == "" {
+		role.Description = b.tokenDescription(defaultUserTokenDescription)
+	}
+
+	if value, ok := data.GetOk("project_key"); ok {
+		role.ProjectKey = value.(string)
+	}
+
+	resp, walID, err := b.createTokenWithWAL(ctx, req.Storage, config, role)
 	if err != nil {
 		return nil, err
 	}
@@ -127,14 +240,15 @@ func (b *backend) pathUserTokenCreatePerform(ctx context.Context, req *logical.R
 		"access_token":    resp.AccessToken,
 		"refresh_token":   resp.RefreshToken,
 		"scope":           resp.Scope,
-		"token_id":        resp.TokenId,
+		"token_id":        resp.TokenID,
 		"username":        role.Username,
 		"description":     role.Description,
 		"reference_token": resp.ReferenceToken,
+		"project_key":     role.ProjectKey,
 	}, map[string]interface{}{
 		"access_token":    resp.AccessToken,
 		"refresh_token":   resp.RefreshToken,
-		"token_id":        resp.TokenId,
+		"token_id":        resp.TokenID,
 		"username":        role.Username,
 		"reference_token": resp.ReferenceToken,
 	})
@@ -142,5 +256,16 @@ func (b *backend) pathUserTokenCreatePerform(ctx context.Context, req *logical.R
 	response.Secret.TTL = ttl
 	response.Secret.MaxTTL = role.MaxTTL
 
+	if err := b.indexIssuedToken(ctx, req.Storage, resp.TokenID, newIssuedToken(req, issuedByUserToken, "", "", role.Username)); err != nil {
+		return nil, fmt.Errorf("error indexing access token: %w", err)
+	}
+
+	// The access token is tracked by the lease from here on
+	if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+		return nil, fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+
+	b.emitTokenIssued("user_token", "")
+
 	return response, nil
 }
@@ -1,7 +1,15 @@
 package artifactory
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
 	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestAcceptanceBackend_PathUserTokenCreate(t *testing.T) {
@@ -18,3 +26,358 @@ func TestAcceptanceBackend_PathUserTokenCreate(t *testing.T) {
 	t.Run("create token for admin user", accTestEnv.CreatePathUserToken)
 	t.Run("cleanup backend", accTestEnv.DeletePathConfig)
 }
+
+func TestBackend_PathUserTokenCreateWithProject(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/projects/proj",
+		httpmock.NewStringResponder(200, `{"project_key": "proj"}`))
+
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		"http://myserver.com:80/access/api/v1/projects/nope",
+		httpmock.NewStringResponder(404, ""))
+
+	var tokenRequest access.CreateTokenRequest
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			tokenRequest = access.CreateTokenRequest{}
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&tokenRequest))
+			return httpmock.NewStringResponse(200, jwtAccessToken), nil
+		})
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/user_token",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"project_key": "nope",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `project "nope" does not exist`)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/user_token",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"project_key": "proj",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, "proj", tokenRequest.ProjectKey)
+	assert.Equal(t, "proj", resp.Data["project_key"])
+
+	// The request overrides the configured project
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"project_key": "",
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Empty(t, tokenRequest.ProjectKey)
+}
+
+func TestBackend_PathUserTokenCreateAllowedUsernames(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/user_token",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"allowed_usernames": "*@example.com,ci-*",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	for _, username := range []string{"jdoe@example.com", "ci-builds"} {
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "user_token/" + username,
+			Storage:   config.StorageView,
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, resp.Secret, username)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `username "admin" is not allowed`)
+}
+
+func TestBackend_PathUserTokenEntityBinding(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	var tokenRequest access.CreateTokenRequest
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			tokenRequest = access.CreateTokenRequest{}
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&tokenRequest))
+			return httpmock.NewStringResponse(200, jwtAccessToken), nil
+		})
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	config.System.(*logical.StaticSystemView).EntityVal = &logical.Entity{
+		ID:   "test-entity-id",
+		Name: "entity-jdoe",
+		Aliases: []*logical.Alias{
+			{MountAccessor: "auth_oidc_1234", Name: "JDoe"},
+		},
+	}
+
+	// user_token/self requires an entity_binding
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/self",
+		Storage:   config.StorageView,
+		EntityID:  "test-entity-id",
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "entity_binding is not configured")
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/user_token",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"entity_binding": "{{identity.entity.aliases.auth_oidc_1234.name}}",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/self",
+		Storage:   config.StorageView,
+		EntityID:  "test-entity-id",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp.Secret)
+	assert.Equal(t, "JDoe", resp.Data["username"])
+	assert.Equal(t, "JDoe", tokenRequest.Username)
+
+	// The username of the path must be the username of the caller
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/jdoe",
+		Storage:   config.StorageView,
+		EntityID:  "test-entity-id",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp.Secret)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/admin",
+		Storage:   config.StorageView,
+		EntityID:  "test-entity-id",
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `username "admin" is not the username of the caller`)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/jdoe",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "the request has no identity entity")
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/user_token",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"entity_binding": "jdoe",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "entity_binding must be an identity template")
+}
+
+func TestBackend_PathUserTokenCreateConfigDefaults(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	var tokenRequest access.CreateTokenRequest
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			tokenRequest = access.CreateTokenRequest{}
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&tokenRequest))
+			return httpmock.NewStringResponse(200, jwtAccessToken), nil
+		})
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/user_token",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"audience":                "jfrt@*",
+			"refreshable":             true,
+			"include_reference_token": true,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp.Secret)
+	assert.Equal(t, "jfrt@*", tokenRequest.Audience)
+	assert.True(t, tokenRequest.Refreshable)
+	assert.True(t, tokenRequest.IncludeReferenceToken)
+
+	// The request overrides the defaults
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"audience":                "jfac@*",
+			"refreshable":             false,
+			"include_reference_token": false,
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp.Secret)
+	assert.Equal(t, "jfac@*", tokenRequest.Audience)
+	assert.False(t, tokenRequest.Refreshable)
+	assert.False(t, tokenRequest.IncludeReferenceToken)
+}
+
+func TestBackend_PathUserTokenCreateLockedFields(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/user_token",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"locked_fields": "nope",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `unknown locked field "nope"`)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/user_token",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"locked_fields": "refreshable,max_ttl",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"refreshable": true,
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "refreshable is locked by config/user_token")
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"description": "laptop",
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp.Secret)
+}
@@ -0,0 +1,143 @@
+package artifactory
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	scopeUser           = "applied-permissions/user"
+	scopeAdmin          = "applied-permissions/admin"
+	scopeGroupsPrefix   = "applied-permissions/groups:"
+	scopeRolesPrefix    = "applied-permissions/roles:"
+	scopeMemberOfGroups = "member-of-groups:"
+	scopeAPI            = "api:*"
+	scopeSystemPrefix   = "system:"
+
+	// identityTemplatePlaceholder replaces identity templates, when validating the grammar of a scope
+	identityTemplatePlaceholder = "vaultidentitytemplate"
+)
+
+var (
+	identityTemplateDirective = regexp.MustCompile(`{{[^}]*}}`)
+	scopeProjectKeyRegex      = regexp.MustCompile(`^[a-z][a-z0-9]{1,31}$`)
+	scopeSystemRegex          = regexp.MustCompile(`^system:[a-z]+:[a-z*]+$`)
+)
+
+// scopeElement is a single permission of a scope, such as one group of applied-permissions/groups.
+// Policies of allowed scopes are matched against the elements of scopes.
+type scopeElement struct {
+	// Element is the scope of this permission alone, such as applied-permissions/groups:readers
+	Element string
+	// Group is the group named by the element, if any
+	Group string
+	// Templated is true if the element has identity templates, which are only known when tokens are issued
+	Templated bool
+}
+
+// parseScope validates the grammar of a space-delimited JFrog access token scope, returning its elements.
+// Identity templates are replaced by a placeholder, and the elements using them are marked as templated.
+func parseScope(scope string) ([]scopeElement, error) {
+	templated := identityTemplateDirective.ReplaceAllString(scope, identityTemplatePlaceholder)
+
+	tokens := strings.Fields(templated)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("missing scope")
+	}
+
+	var elements []scopeElement
+	for _, token := range tokens {
+		tokenElements, err := parseScopeToken(token)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, element := range tokenElements {
+			if strings.Contains(element.Element, identityTemplatePlaceholder) {
+				element.Templated = true
+				element.Group = ""
+			}
+			elements = append(elements, element)
+		}
+	}
+
+	return elements, nil
+}
+
+func parseScopeToken(token string) ([]scopeElement, error) {
+	switch {
+	case token == scopeUser, token == scopeAdmin, token == scopeAPI:
+		return []scopeElement{{Element: token}}, nil
+
+	case strings.HasPrefix(token, scopeGroupsPrefix):
+		return parseScopeGroups(token, scopeGroupsPrefix, false)
+
+	case strings.HasPrefix(token, scopeMemberOfGroups):
+		return parseScopeGroups(token, scopeMemberOfGroups, true)
+
+	case strings.HasPrefix(token, scopeRolesPrefix):
+		projectKey, roles, found := strings.Cut(strings.TrimPrefix(token, scopeRolesPrefix), ":")
+		if !found || !scopeProjectKeyRegex.MatchString(projectKey) {
+			return nil, fmt.Errorf("invalid scope %q, must be %s<project key>:<roles>", token, scopeRolesPrefix)
+		}
+
+		names, err := parseScopeList(token, roles)
+		if err != nil {
+			return nil, err
+		}
+
+		elements := make([]scopeElement, 0, len(names))
+		for _, role := range names {
+			elements = append(elements, scopeElement{Element: scopeRolesPrefix + projectKey + ":" + role})
+		}
+		return elements, nil
+
+	case strings.HasPrefix(token, scopeSystemPrefix):
+		if !scopeSystemRegex.MatchString(token) {
+			return nil, fmt.Errorf("invalid scope %q, must be system:<resource>:<permissions>", token)
+		}
+		return []scopeElement{{Element: token}}, nil
+	}
+
+	return nil, fmt.Errorf("invalid scope %q, must be one of %s, %s, %s<groups>, %s<project key>:<roles>, %s<groups>, %s or system:<resource>:<permissions>",
+		token, scopeUser, scopeAdmin, scopeGroupsPrefix, scopeRolesPrefix, scopeMemberOfGroups, scopeAPI)
+}
+
+func parseScopeGroups(token, prefix string, allowWildcard bool) ([]scopeElement, error) {
+	groups, err := parseScopeList(token, strings.TrimPrefix(token, prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	elements := make([]scopeElement, 0, len(groups))
+	for _, group := range groups {
+		element := scopeElement{Element: prefix + group}
+
+		if group == "*" {
+			if !allowWildcard {
+				return nil, fmt.Errorf("invalid scope %q, groups can't be '*'", token)
+			}
+		} else {
+			element.Group = group
+		}
+
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// parseScopeList parses a comma separated list of names, which may be quoted
+func parseScopeList(token, list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if len(name) > 1 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+			name = name[1 : len(name)-1]
+		}
+		if len(name) == 0 || strings.Contains(name, `"`) {
+			return nil, fmt.Errorf("invalid scope %q, names must not be empty or partly quoted", token)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,55 @@
+package artifactory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScope(t *testing.T) {
+	elements, err := parseScope(`applied-permissions/groups:readers,"dev-team" applied-permissions/roles:proj:Developer,Viewer system:metrics:r`)
+	assert.NoError(t, err)
+	assert.Equal(t, []scopeElement{
+		{Element: "applied-permissions/groups:readers", Group: "readers"},
+		{Element: "applied-permissions/groups:dev-team", Group: "dev-team"},
+		{Element: "applied-permissions/roles:proj:Developer"},
+		{Element: "applied-permissions/roles:proj:Viewer"},
+		{Element: "system:metrics:r"},
+	}, elements)
+
+	for _, scope := range []string{
+		"applied-permissions/user",
+		"applied-permissions/admin",
+		"api:* member-of-groups:readers,ci",
+		"member-of-groups:*",
+	} {
+		_, err := parseScope(scope)
+		assert.NoError(t, err, scope)
+	}
+}
+
+func TestParseScope_Invalid(t *testing.T) {
+	for scope, message := range map[string]string{
+		"":                                  "missing scope",
+		"applied-permissions/group:readers": `invalid scope "applied-permissions/group:readers"`,
+		"applied-permissions/groups:":       "names must not be empty",
+		"applied-permissions/groups:a,,b":   "names must not be empty",
+		"applied-permissions/groups:*":      "groups can't be '*'",
+		"applied-permissions/roles:proj":    "must be applied-permissions/roles:<project key>:<roles>",
+		"applied-permissions/roles:PROJ:a":  "must be applied-permissions/roles:<project key>:<roles>",
+		"system:metrics":                    "must be system:<resource>:<permissions>",
+		"api:read":                          `invalid scope "api:read"`,
+	} {
+		_, err := parseScope(scope)
+		assert.ErrorContains(t, err, message, scope)
+	}
+}
+
+func TestParseScope_IdentityTemplates(t *testing.T) {
+	elements, err := parseScope("applied-permissions/groups:readers,{{identity.entity.metadata.groups}}")
+	assert.NoError(t, err)
+	assert.Equal(t, []scopeElement{
+		{Element: "applied-permissions/groups:readers", Group: "readers"},
+		{Element: "applied-permissions/groups:" + identityTemplatePlaceholder, Templated: true},
+	}, elements)
+}
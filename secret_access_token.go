@@ -3,6 +3,7 @@ package artifactory
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -33,28 +34,53 @@ func (b *backend) secretAccessToken() *framework.Secret {
 	}
 }
 
-func (b *backend) secretAccessTokenRenew(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
-	resp := &logical.Response{Secret: req.Secret}
+func (b *backend) secretAccessTokenRenew(ctx context.Context, req *logical.Request, _ *framework.FieldData) (resp *logical.Response, err error) {
+	roleName, _ := req.Secret.InternalData["role"].(string)
+	defer func() {
+		renewErr := err
+		if renewErr == nil && resp.IsError() {
+			renewErr = resp.Error()
+		}
+		b.emitTokenRenewal(roleName, renewErr)
+	}()
+
+	resp = &logical.Response{Secret: req.Secret}
 
-	config, err := b.fetchAdminConfiguration(ctx, req.Storage)
+	connection, _ := req.Secret.InternalData["connection"].(string)
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
 
 	if config == nil {
-		return logical.ErrorResponse("backend not configured"), nil
+		return notConfiguredResponse(connection), nil
 	}
 
 	if !req.Secret.Renewable {
 		return nil, fmt.Errorf("lease cannot be renewed")
 	}
 
-	role, err := b.Role(ctx, req.Storage, req.Secret.InternalData["role"].(string))
-	if err != nil {
-		return nil, fmt.Errorf("error during renew: could not get role: %q", req.Secret.InternalData["role"])
-	}
-	if role == nil {
-		return nil, fmt.Errorf("error during renew: could not find role with name: %q", req.Secret.InternalData["role"])
+	var role *artifactoryRole
+
+	if roleName, ok := req.Secret.InternalData["role"].(string); ok {
+		role, err = b.Role(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, fmt.Errorf("error during renew: could not get role: %q", roleName)
+		}
+		if role == nil {
+			return nil, fmt.Errorf("error during renew: could not find role with name: %q", roleName)
+		}
+	} else {
+		// Leases of user tokens have no role, the TTLs of config/user_token apply
+		userTokenConfig, err := b.fetchUserTokenConfiguration(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		role = &artifactoryRole{
+			DefaultTTL: userTokenConfig.DefaultTTL,
+			MaxTTL:     userTokenConfig.MaxTTL,
+		}
 	}
 
 	ttl, warnings, err :=
@@ -70,23 +96,146 @@ func (b *backend) secretAccessTokenRenew(ctx context.Context, req *logical.Reque
 
 	resp.Secret.TTL = ttl
 
+	// Tokens of refreshable roles are refreshed, which renews them in Artifactory for their original lifetime.
+	// Artifactory can't change the lifetime on refresh, so the lease is capped to it.
+	role.DefaultTTL = ttl
+	if role.Refreshable && b.tokenExpiresIn(ctx, *config, *role) > 0 {
+		if err := b.refreshSecret(ctx, req.Storage, *config, resp); err != nil {
+			return nil, fmt.Errorf("error during renew: %w", err)
+		}
+	}
+
 	return resp, nil
 }
 
+// refreshSecret replaces the access token of the lease with a refreshed one, returning it to the client.
+// The refreshed token replaces the revoked one in the index of issued tokens. The lease TTL is capped to the
+// lifetime of the refreshed token, which is the one the token was created with.
+func (b *backend) refreshSecret(ctx context.Context, storage logical.Storage, config adminConfiguration, resp *logical.Response) error {
+	tokenID, _ := resp.Secret.InternalData["token_id"].(string)
+	accessToken, _ := resp.Secret.InternalData["access_token"].(string)
+	refreshToken, _ := resp.Secret.InternalData["refresh_token"].(string)
+
+	if len(refreshToken) == 0 {
+		return fmt.Errorf("access token is not refreshable")
+	}
+
+	refreshed, err := b.RefreshToken(ctx, config, accessToken, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	resp.Secret.InternalData["access_token"] = refreshed.AccessToken
+	resp.Secret.InternalData["refresh_token"] = refreshed.RefreshToken
+	resp.Secret.InternalData["token_id"] = refreshed.TokenID
+	resp.Secret.InternalData["reference_token"] = refreshed.ReferenceToken
+
+	resp.Data = map[string]interface{}{
+		"access_token":    refreshed.AccessToken,
+		"refresh_token":   refreshed.RefreshToken,
+		"token_id":        refreshed.TokenID,
+		"reference_token": refreshed.ReferenceToken,
+	}
+
+	if expiresIn := time.Duration(refreshed.ExpiresIn) * time.Second; expiresIn > 0 && resp.Secret.TTL > expiresIn {
+		resp.AddWarning(fmt.Sprintf("TTL of %s is capped to the lifetime of the refreshed access token, %s", resp.Secret.TTL, expiresIn))
+		resp.Secret.TTL = expiresIn
+	}
+
+	// The old access token is revoked by Artifactory already, so failing the renewal here would leave the lease
+	// with a revoked token; the failure is only logged
+	if err := b.reindexIssuedToken(ctx, storage, tokenID, refreshed.TokenID, resp.Secret.InternalData); err != nil {
+		b.Logger().Error("error indexing refreshed access token", "tokenId", refreshed.TokenID, "err", err)
+	}
+
+	return nil
+}
+
+// reindexIssuedToken moves the index entry of a refreshed access token to the ID of the new token. A lease
+// whose token isn't in the index gets an entry from its internal data.
+func (b *backend) reindexIssuedToken(ctx context.Context, storage logical.Storage, oldTokenID, newTokenID string, internalData map[string]interface{}) error {
+	issued, err := b.fetchIssuedToken(ctx, storage, oldTokenID)
+	if err != nil {
+		return err
+	}
+
+	if issued == nil {
+		role, _ := internalData["role"].(string)
+		connection, _ := internalData["connection"].(string)
+		username, _ := internalData["username"].(string)
+
+		issued = &issuedToken{
+			IssuedBy:   issuedByRole,
+			Role:       role,
+			Connection: connection,
+			Username:   username,
+			IssuedAt:   time.Now(),
+		}
+		if len(role) == 0 {
+			issued.IssuedBy = issuedByUserToken
+		}
+	}
+
+	if err := b.indexIssuedToken(ctx, storage, newTokenID, *issued); err != nil {
+		return err
+	}
+
+	b.unindexIssuedToken(ctx, storage, oldTokenID)
+
+	return nil
+}
+
 func (b *backend) secretAccessTokenRevoke(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
-	config, err := b.fetchAdminConfiguration(ctx, req.Storage)
+	connection, _ := req.Secret.InternalData["connection"].(string)
 
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
 
 	if config == nil {
-		return logical.ErrorResponse("backend not configured"), nil
+		return notConfiguredResponse(connection), nil
 	}
 
-	if err := b.RevokeToken(*config, *req.Secret); err != nil {
-		return nil, err
+	tokenID, _ := req.Secret.InternalData["token_id"].(string)
+
+	if err := b.revokeSecret(ctx, *config, req.Secret.InternalData); err != nil {
+		// Revoke the lease in Vault regardless, the backend keeps retrying the revocation in Artifactory
+		b.Logger().Warn("error revoking access token, queued for retry", "tokenId", tokenID, "err", err)
+
+		if err := b.enqueueRevocation(ctx, req.Storage, req.Secret.InternalData, err); err != nil {
+			return nil, fmt.Errorf("error queueing revocation: %w", err)
+		}
+		return nil, nil
 	}
 
+	b.unindexIssuedToken(ctx, req.Storage, tokenID)
+
 	return nil, nil
 }
+
+// revokeSecret revokes what was created in Artifactory for a lease, from its InternalData.
+// Completed steps are recorded in internalData, so that a retry resumes where it failed.
+func (b *backend) revokeSecret(ctx context.Context, config adminConfiguration, internalData map[string]interface{}) error {
+	if revoked, _ := internalData["token_revoked"].(bool); !revoked {
+		if err := b.RevokeToken(ctx, config, logical.Secret{InternalData: internalData}); err != nil {
+			return err
+		}
+		internalData["token_revoked"] = true
+	}
+
+	if permissionTarget, _ := internalData["permission_target"].(string); len(permissionTarget) > 0 {
+		if err := b.deletePermissionTarget(ctx, config, permissionTarget); err != nil {
+			return err
+		}
+	}
+
+	if createdUser, _ := internalData["created_user"].(bool); createdUser {
+		username, _ := internalData["username"].(string)
+		if err := b.deleteUser(ctx, config, username); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
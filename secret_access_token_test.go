@@ -0,0 +1,259 @@
+package artifactory
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockTokenAndRefreshRequests answers token creation with "created-token" and refresh with "refreshed-token"
+func mockTokenAndRefreshRequests(t *testing.T) {
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Content-Type") == "application/json" {
+				return httpmock.NewStringResponse(200, `{
+					"token_id": "created-token-id",
+					"access_token": "created-token",
+					"refresh_token": "created-refresh-token",
+					"expires_in": 600,
+					"scope": "applied-permissions/user",
+					"token_type": "Bearer"
+				}`), nil
+			}
+
+			assert.NoError(t, req.ParseForm())
+			assert.Equal(t, "refresh_token", req.PostForm.Get("grant_type"))
+			assert.Equal(t, "created-refresh-token", req.PostForm.Get("refresh_token"))
+			assert.Equal(t, "created-token", req.PostForm.Get("access_token"))
+
+			return httpmock.NewStringResponse(200, `{
+				"token_id": "refreshed-token-id",
+				"access_token": "refreshed-token",
+				"refresh_token": "refreshed-refresh-token",
+				"expires_in": 600,
+				"scope": "applied-permissions/user",
+				"token_type": "Bearer"
+			}`), nil
+		})
+}
+
+func TestBackend_RenewRefreshesToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+	mockTokenAndRefreshRequests(t)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token":        "test-access-token",
+		"url":                 "http://myserver.com:80",
+		"use_expiring_tokens": true,
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":    "test-username",
+			"scope":       "applied-permissions/user",
+			"refreshable": true,
+			"default_ttl": 5 * time.Minute,
+			"max_ttl":     10 * time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "created-token", resp.Data["access_token"])
+
+	secret := resp.Secret
+	secret.Renewable = true
+	secret.IssueTime = time.Now()
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Secret:    secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, "refreshed-token", resp.Data["access_token"])
+	assert.Equal(t, "refreshed-token-id", resp.Data["token_id"])
+	assert.Equal(t, "refreshed-token", resp.Secret.InternalData["access_token"])
+	assert.Equal(t, "refreshed-refresh-token", resp.Secret.InternalData["refresh_token"])
+	assert.Equal(t, "refreshed-token-id", resp.Secret.InternalData["token_id"])
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+
+	// The refreshed token replaces the revoked one in the index, so that tidy leaves it alone
+	issued, err := b.fetchIssuedToken(context.Background(), config.StorageView, "refreshed-token-id")
+	assert.NoError(t, err)
+	if assert.NotNil(t, issued) {
+		assert.Equal(t, issuedByRole, issued.IssuedBy)
+		assert.Equal(t, "test-role", issued.Role)
+	}
+
+	issued, err = b.fetchIssuedToken(context.Background(), config.StorageView, "created-token-id")
+	assert.NoError(t, err)
+	assert.Nil(t, issued)
+}
+
+// Without expiring tokens, renewing only extends the lease
+func TestBackend_RenewWithoutExpiringTokensDoesNotRefresh(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+	mockTokenAndRefreshRequests(t)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":    "test-username",
+			"scope":       "applied-permissions/user",
+			"refreshable": true,
+			"default_ttl": 5 * time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+
+	secret := resp.Secret
+	secret.Renewable = true
+	secret.IssueTime = time.Now()
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Secret:    secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Nil(t, resp.Data)
+	assert.Equal(t, "created-token", resp.Secret.InternalData["access_token"])
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://myserver.com:80/access/api/v1/tokens"])
+}
+
+// Leases of user tokens have no role, they are renewed with the TTLs of config/user_token
+func TestBackend_RenewUserToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+	mockTokenAndRefreshRequests(t)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/user_token",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"default_ttl": 5 * time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user_token/admin",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+
+	secret := resp.Secret
+	secret.Renewable = true
+	secret.IssueTime = time.Now()
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Secret:    secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, 5*time.Minute, resp.Secret.TTL)
+}
+
+// Artifactory refreshes a token for its original lifetime, so the renewed lease can't outlive it
+func TestBackend_RenewCappedToRefreshedTokenLifetime(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+	mockTokenAndRefreshRequests(t)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token":        "test-access-token",
+		"url":                 "http://myserver.com:80",
+		"use_expiring_tokens": true,
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":    "test-username",
+			"scope":       "applied-permissions/user",
+			"refreshable": true,
+			"default_ttl": 5 * time.Minute,
+			"max_ttl":     time.Hour,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+
+	secret := resp.Secret
+	secret.Renewable = true
+	secret.IssueTime = time.Now()
+	secret.Increment = 30 * time.Minute
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Secret:    secret,
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "refreshed-token", resp.Data["access_token"])
+	assert.Equal(t, 10*time.Minute, resp.Secret.TTL)
+	assert.Len(t, resp.Warnings, 1)
+}
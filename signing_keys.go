@@ -0,0 +1,143 @@
+package artifactory
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+)
+
+const (
+	// signingKeysTTL is how long the signing keys of a connection are cached
+	signingKeysTTL = time.Hour
+	// signingKeysMinRefresh limits how often the signing keys are refetched because of an unknown
+	// key ID or a bad signature, so that forged tokens can't make us hammer Artifactory
+	signingKeysMinRefresh = time.Minute
+)
+
+var errUnknownSigningKey = errors.New("unknown signing key")
+
+// signingKeys are the keys Artifactory signs access tokens with, cached per connection.
+// The JWKS keys are used when Artifactory provides them, the root certificate otherwise.
+type signingKeys struct {
+	keys      map[string]crypto.PublicKey // by key ID
+	rootCert  crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// key returns the signing key with the key ID
+func (k *signingKeys) key(kid string) (crypto.PublicKey, error) {
+	if len(k.keys) > 0 {
+		if key, ok := k.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("%w: key ID %q", errUnknownSigningKey, kid)
+	}
+
+	return k.rootCert, nil
+}
+
+// getJWKS returns the RSA keys of the Access JWKS endpoint by key ID, or nil if Artifactory doesn't provide it
+func (b *backend) getJWKS(ctx context.Context, config adminConfiguration) (map[string]crypto.PublicKey, error) {
+	client, err := b.accessClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks, err := client.GetJWKS(ctx)
+	if err != nil || jwks == nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, key := range jwks.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if !key.IsPublic() {
+			continue
+		}
+		keys[key.KeyID] = key.Key
+	}
+
+	return keys, nil
+}
+
+// fetchSigningKeys gets the signing keys from Artifactory, and caches them for the connection
+func (b *backend) fetchSigningKeys(ctx context.Context, config adminConfiguration) (*signingKeys, error) {
+	keys := &signingKeys{fetchedAt: time.Now()}
+
+	jwks, err := b.getJWKS(ctx, config)
+	if err != nil {
+		b.Logger().Debug("could not get the JWKS, falling back to the root certificate", "err", err)
+	}
+
+	if len(jwks) > 0 {
+		keys.keys = jwks
+	} else {
+		cert, err := b.getRootCert(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		keys.rootCert = cert.PublicKey
+	}
+
+	b.connectionsMutex.Lock()
+	defer b.connectionsMutex.Unlock()
+	b.connectionStateLocked(config.name).signingKeys = keys
+	return keys, nil
+}
+
+// signingKey returns the key the token with the key ID was signed with. Cached keys are used until
+// they expire, or refetched if forceRefresh is set, such as after a key rotation. When Artifactory
+// can't be reached, expired keys are used rather than failing.
+func (b *backend) signingKey(ctx context.Context, config adminConfiguration, kid string, forceRefresh bool) (crypto.PublicKey, error) {
+	b.connectionsMutex.RLock()
+	var cached *signingKeys
+	if state, ok := b.connections[config.name]; ok {
+		cached = state.signingKeys
+	}
+	b.connectionsMutex.RUnlock()
+
+	if cached != nil {
+		age := time.Since(cached.fetchedAt)
+		if age < signingKeysMinRefresh || (age < signingKeysTTL && !forceRefresh) {
+			return cached.key(kid)
+		}
+	}
+
+	keys, err := b.fetchSigningKeys(ctx, config)
+	if err != nil {
+		if cached != nil && !errors.Is(err, access.ErrIncompatibleVersion) {
+			b.Logger().Warn("could not refresh the signing keys, using the cached keys", "err", err)
+			return cached.key(kid)
+		}
+		return nil, err
+	}
+
+	return keys.key(kid)
+}
+
+// verifyJWT parses the token and verifies its signature. If the signing key is unknown or the
+// signature is invalid, the signing keys are refreshed once, in case Artifactory rotated them.
+func (b *backend) verifyJWT(ctx context.Context, config adminConfiguration, token string, options ...jwt.ParserOption) (*jwt.Token, error) {
+	options = append([]jwt.ParserOption{jwt.WithValidMethods([]string{"RS256"})}, options...)
+
+	parse := func(forceRefresh bool) (*jwt.Token, error) {
+		return jwt.Parse(token, func(jwtToken *jwt.Token) (interface{}, error) {
+			kid, _ := jwtToken.Header["kid"].(string)
+			return b.signingKey(ctx, config, kid, forceRefresh)
+		}, options...)
+	}
+
+	jwtToken, err := parse(false)
+	if errors.Is(err, errUnknownSigningKey) || errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		jwtToken, err = parse(true)
+	}
+
+	return jwtToken, err
+}
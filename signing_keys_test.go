@@ -0,0 +1,197 @@
+package artifactory
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jarcoal/httpmock"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRootCertURL = "http://myserver.com:80/access/api/v1/cert/root"
+	testJWKSURL     = "http://myserver.com:80/access/api/v1/cert/jwks"
+)
+
+// accessTokenWithKeyID returns a signed access token with the kid header set
+func (s *testTokenSigner) accessTokenWithKeyID(t *testing.T, kid, tokenID string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "jfac@01h424hvwpytzk1azxh6k807e5/users/admin",
+		"scp": "applied-permissions/admin",
+		"jti": tokenID,
+	})
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(s.key)
+	assert.NoError(t, err)
+
+	return signed
+}
+
+// jwks returns the JSON body of a JWKS response with the signer's key under the key ID
+func (s *testTokenSigner) jwks(t *testing.T, kid string) string {
+	body, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &s.key.PublicKey,
+		KeyID:     kid,
+		Algorithm: "RS256",
+		Use:       "sig",
+	}}})
+	assert.NoError(t, err)
+
+	return string(body)
+}
+
+// switchableResponder responds with the status and body currently set, so that call counts aren't
+// reset by registering a new responder
+type switchableResponder struct {
+	status int
+	body   string
+}
+
+func (r *switchableResponder) responder() httpmock.Responder {
+	return func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(r.status, r.body), nil
+	}
+}
+
+// ageSigningKeys makes the cached signing keys of the default connection look older
+func ageSigningKeys(b *backend, age time.Duration) {
+	b.connectionsMutex.Lock()
+	defer b.connectionsMutex.Unlock()
+	b.connections[""].signingKeys.fetchedAt = time.Now().Add(-age)
+}
+
+func TestBackend_SigningKeysCached(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	signer := newTestTokenSigner(t)
+	rootCert := &switchableResponder{status: 200, body: signer.rootCert}
+	httpmock.RegisterResponder(http.MethodGet, testRootCertURL, rootCert.responder())
+	httpmock.RegisterResponder(http.MethodGet, testJWKSURL, httpmock.NewStringResponder(404, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	adminConfig, err := b.fetchAdminConfiguration(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+
+	token := signer.accessToken(t, "token-id", "admin", "applied-permissions/admin", time.Hour)
+
+	for i := 0; i < 3; i++ {
+		info, err := b.getTokenInfo(context.Background(), *adminConfig, token)
+		assert.NoError(t, err)
+		assert.Equal(t, "token-id", info.TokenID)
+	}
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET "+testRootCertURL])
+
+	// Expired keys are refetched
+	ageSigningKeys(b, signingKeysTTL)
+
+	_, err = b.getTokenInfo(context.Background(), *adminConfig, token)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["GET "+testRootCertURL])
+
+	// Expired keys are still used when Artifactory can't be reached
+	ageSigningKeys(b, signingKeysTTL)
+	rootCert.status = 503
+
+	_, err = b.getTokenInfo(context.Background(), *adminConfig, token)
+	assert.NoError(t, err)
+	assert.Equal(t, 3+access.MaxRetries, httpmock.GetCallCountInfo()["GET "+testRootCertURL])
+
+	// Resetting the connection clears the cache
+	b.reset("")
+	_, err = b.getTokenInfo(context.Background(), *adminConfig, token)
+	assert.Error(t, err)
+}
+
+func TestBackend_SigningKeysRootCertRotated(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	oldSigner := newTestTokenSigner(t)
+	rootCert := &switchableResponder{status: 200, body: oldSigner.rootCert}
+	httpmock.RegisterResponder(http.MethodGet, testRootCertURL, rootCert.responder())
+	httpmock.RegisterResponder(http.MethodGet, testJWKSURL, httpmock.NewStringResponder(404, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	adminConfig, err := b.fetchAdminConfiguration(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+
+	_, err = b.getTokenInfo(context.Background(), *adminConfig, oldSigner.accessToken(t, "old-token-id", "admin", "applied-permissions/admin", time.Hour))
+	assert.NoError(t, err)
+
+	newSigner := newTestTokenSigner(t)
+	rootCert.body = newSigner.rootCert
+	newToken := newSigner.accessToken(t, "new-token-id", "admin", "applied-permissions/admin", time.Hour)
+
+	// Keys that were just fetched aren't refetched for a bad signature
+	_, err = b.getTokenInfo(context.Background(), *adminConfig, newToken)
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET "+testRootCertURL])
+
+	ageSigningKeys(b, 2*signingKeysMinRefresh)
+
+	info, err := b.getTokenInfo(context.Background(), *adminConfig, newToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "new-token-id", info.TokenID)
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["GET "+testRootCertURL])
+}
+
+func TestBackend_SigningKeysJWKS(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	oldSigner := newTestTokenSigner(t)
+	jwks := &switchableResponder{status: 200, body: oldSigner.jwks(t, "key-1")}
+	httpmock.RegisterResponder(http.MethodGet, testJWKSURL, jwks.responder())
+	httpmock.RegisterResponder(http.MethodGet, testRootCertURL, httpmock.NewStringResponder(500, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	adminConfig, err := b.fetchAdminConfiguration(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+
+	info, err := b.getTokenInfo(context.Background(), *adminConfig, oldSigner.accessTokenWithKeyID(t, "key-1", "old-token-id"))
+	assert.NoError(t, err)
+	assert.Equal(t, "old-token-id", info.TokenID)
+
+	// After a key rotation, an unknown key ID refetches the JWKS
+	newSigner := newTestTokenSigner(t)
+	jwks.body = newSigner.jwks(t, "key-2")
+	newToken := newSigner.accessTokenWithKeyID(t, "key-2", "new-token-id")
+
+	_, err = b.getTokenInfo(context.Background(), *adminConfig, newToken)
+	assert.ErrorIs(t, err, errUnknownSigningKey)
+
+	ageSigningKeys(b, 2*signingKeysMinRefresh)
+
+	info, err = b.getTokenInfo(context.Background(), *adminConfig, newToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "new-token-id", info.TokenID)
+
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["GET "+testJWKSURL])
+	assert.Equal(t, 0, httpmock.GetCallCountInfo()["GET "+testRootCertURL])
+}
@@ -45,17 +45,17 @@ func (e *accTestEnv) createNewTestToken(t *testing.T) (string, string) {
 
 	e.Backend.(*backend).InitializeHttpClient(&config)
 
-	err := e.Backend.(*backend).getVersion(config)
+	err := e.Backend.(*backend).getVersion(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	resp, err := e.Backend.(*backend).CreateToken(config, role)
+	resp, err := e.Backend.(*backend).CreateToken(context.Background(), config, role)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	return resp.TokenId, resp.AccessToken
+	return resp.TokenID, resp.AccessToken
 }
 
 // createNewNonAdminTestToken creates a new "user" token using the one from test environment
@@ -72,17 +72,17 @@ func (e *accTestEnv) createNewNonAdminTestToken(t *testing.T) (string, string) {
 		Scope:     "applied-permissions/groups:readers",
 	}
 
-	err := e.Backend.(*backend).getVersion(config)
+	err := e.Backend.(*backend).getVersion(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	resp, err := e.Backend.(*backend).CreateToken(config, role)
+	resp, err := e.Backend.(*backend).CreateToken(context.Background(), config, role)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	return resp.TokenId, resp.AccessToken
+	return resp.TokenID, resp.AccessToken
 }
 
 func (e *accTestEnv) revokeTestToken(t *testing.T, accessToken string, tokenID string) {
@@ -91,7 +91,7 @@ func (e *accTestEnv) revokeTestToken(t *testing.T, accessToken string, tokenID s
 		ArtifactoryURL: e.URL,
 	}
 
-	err := e.Backend.(*backend).getVersion(config)
+	err := e.Backend.(*backend).getVersion(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -103,7 +103,7 @@ func (e *accTestEnv) revokeTestToken(t *testing.T, accessToken string, tokenID s
 		},
 	}
 
-	err = e.Backend.(*backend).RevokeToken(config, secret)
+	err = e.Backend.(*backend).RevokeToken(context.Background(), config, secret)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -389,11 +389,12 @@ const artVersion = `{
     "license": "05179b957028fa9aa1ceb88da6519a245e55b9fc5"
 }`
 
-func makeBackend(t *testing.T) (*backend, *logical.BackendConfig) {
+func makeBackend(t *testing.T, opts ...backendOption) (*backend, *logical.BackendConfig) {
 	config := logical.TestBackendConfig()
 	config.StorageView = &logical.InmemStorage{}
+	config.BackendUUID = "test-backend-uuid"
 
-	b, err := Backend(config)
+	b, err := newBackend(config, opts...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -405,9 +406,9 @@ func makeBackend(t *testing.T) (*backend, *logical.BackendConfig) {
 	return b, config
 }
 
-func configuredBackend(t *testing.T, adminConfig map[string]interface{}) (*backend, *logical.BackendConfig) {
+func configuredBackend(t *testing.T, adminConfig map[string]interface{}, opts ...backendOption) (*backend, *logical.BackendConfig) {
 
-	b, config := makeBackend(t)
+	b, config := makeBackend(t, opts...)
 
 	_, err := b.HandleRequest(context.Background(), &logical.Request{
 		Operation: logical.UpdateOperation,
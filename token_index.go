@@ -0,0 +1,81 @@
+package artifactory
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	issuedTokensPrefix = "issued/"
+
+	issuedByRole       = "role"
+	issuedByUserToken  = "user_token"
+	issuedByStaticRole = "static_role"
+)
+
+// issuedToken records which Vault role or path issued an access token, by token ID.
+// Entries are deleted once the access token is revoked.
+type issuedToken struct {
+	IssuedBy    string    `json:"issued_by"`
+	Role        string    `json:"role,omitempty"`
+	Connection  string    `json:"connection,omitempty"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name,omitempty"`
+	EntityID    string    `json:"entity_id,omitempty"`
+	RequestPath string    `json:"request_path,omitempty"`
+	IssuedAt    time.Time `json:"issued_at"`
+}
+
+// newIssuedToken returns the index entry of an access token issued for the request
+func newIssuedToken(req *logical.Request, issuedBy, role, connection, username string) issuedToken {
+	return issuedToken{
+		IssuedBy:    issuedBy,
+		Role:        role,
+		Connection:  connection,
+		Username:    username,
+		DisplayName: req.DisplayName,
+		EntityID:    req.EntityID,
+		RequestPath: req.MountPoint + req.Path,
+		IssuedAt:    time.Now(),
+	}
+}
+
+func (b *backend) indexIssuedToken(ctx context.Context, storage logical.Storage, tokenID string, issued issuedToken) error {
+	entry, err := logical.StorageEntryJSON(issuedTokensPrefix+tokenID, issued)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
+// fetchIssuedToken returns nil, nil if the access token isn't in the index
+func (b *backend) fetchIssuedToken(ctx context.Context, storage logical.Storage, tokenID string) (*issuedToken, error) {
+	entry, err := storage.Get(ctx, issuedTokensPrefix+tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	var issued issuedToken
+	if err := entry.DecodeJSON(&issued); err != nil {
+		return nil, err
+	}
+
+	return &issued, nil
+}
+
+// unindexIssuedToken removes a revoked access token from the index, failures are only logged
+func (b *backend) unindexIssuedToken(ctx context.Context, storage logical.Storage, tokenID string) {
+	if len(tokenID) == 0 {
+		return
+	}
+
+	if err := storage.Delete(ctx, issuedTokensPrefix+tokenID); err != nil {
+		b.Logger().Warn("error removing revoked access token from the index", "tokenId", tokenID, "err", err)
+	}
+}
@@ -0,0 +1,150 @@
+package artifactory
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the tracer of the backend's spans
+const tracerName = "github.com/jfrog/vault-plugin-secrets-artifactory"
+
+// ConfigureTracing exports the traces of the plugin with OTLP over HTTP when the OTEL_EXPORTER_OTLP_ENDPOINT
+// or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT environment variable is set, configured by the standard OTEL_*
+// environment variables. The returned function flushes and stops the exporter; tracing stays disabled,
+// and the function does nothing, when neither variable is set.
+func ConfigureTracing(ctx context.Context) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the service name
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(
+			semconv.ServiceName("vault-plugin-secrets-artifactory"),
+			semconv.ServiceVersion(Version),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return tracerProvider.Shutdown, nil
+}
+
+// withTracerProvider makes the backend trace its requests with the tracer provider
+func withTracerProvider(tracerProvider trace.TracerProvider) backendOption {
+	return func(b *backend) {
+		b.tracerProvider = tracerProvider
+	}
+}
+
+// tracer returns the tracer of the backend's spans
+func (b *backend) tracer() trace.Tracer {
+	return b.tracerProvider.Tracer(tracerName)
+}
+
+// startRequestSpan starts the span of a Vault request, named after its operation and the first segment of
+// its path, such as "read token"
+func (b *backend) startRequestSpan(ctx context.Context, req *logical.Request) (context.Context, trace.Span) {
+	name := string(req.Operation)
+	if segment, _, _ := strings.Cut(req.Path, "/"); len(segment) > 0 {
+		name += " " + segment
+	}
+
+	return b.tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("vault.operation", string(req.Operation)),
+			attribute.String("vault.path", req.Path),
+			attribute.String("vault.mount_point", req.MountPoint),
+		))
+}
+
+// endRequestSpan ends the span of a Vault request with its outcome
+func endRequestSpan(span trace.Span, resp *logical.Response, err error) {
+	defer span.End()
+
+	if err == nil && resp.IsError() {
+		err = resp.Error()
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// tracedStorage traces the operations of the storage, as spans of the trace of their context
+type tracedStorage struct {
+	logical.Storage
+	tracer trace.Tracer
+}
+
+func (s *tracedStorage) List(ctx context.Context, prefix string) (keys []string, err error) {
+	ctx, span := s.startSpan(ctx, "list", prefix)
+	defer func() { endStorageSpan(span, err) }()
+
+	return s.Storage.List(ctx, prefix)
+}
+
+func (s *tracedStorage) Get(ctx context.Context, key string) (entry *logical.StorageEntry, err error) {
+	ctx, span := s.startSpan(ctx, "get", key)
+	defer func() { endStorageSpan(span, err) }()
+
+	return s.Storage.Get(ctx, key)
+}
+
+func (s *tracedStorage) Put(ctx context.Context, entry *logical.StorageEntry) (err error) {
+	ctx, span := s.startSpan(ctx, "put", entry.Key)
+	defer func() { endStorageSpan(span, err) }()
+
+	return s.Storage.Put(ctx, entry)
+}
+
+func (s *tracedStorage) Delete(ctx context.Context, key string) (err error) {
+	ctx, span := s.startSpan(ctx, "delete", key)
+	defer func() { endStorageSpan(span, err) }()
+
+	return s.Storage.Delete(ctx, key)
+}
+
+func (s *tracedStorage) startSpan(ctx context.Context, operation, key string) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "storage "+operation,
+		trace.WithAttributes(attribute.String("vault.storage.key", key)))
+}
+
+func endStorageSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
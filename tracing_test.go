@@ -0,0 +1,130 @@
+package artifactory
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// inMemoryTracing returns the option making the backend export its spans to an in-memory exporter, and the exporter
+func inMemoryTracing() (backendOption, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return withTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))), exporter
+}
+
+// findSpan returns the span with the name, failing the test if there's none
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string, attrs ...attribute.KeyValue) tracetest.SpanStub {
+	for _, span := range spans {
+		if span.Name != name {
+			continue
+		}
+		if len(attrs) == 0 || assert.ObjectsAreEqual(attrs, filterAttributes(span.Attributes, attrs)) {
+			return span
+		}
+	}
+
+	t.Fatalf("no span %q with attributes %v", name, attrs)
+	return tracetest.SpanStub{}
+}
+
+// filterAttributes returns the attributes with the keys of the wanted attributes
+func filterAttributes(attributes, wanted []attribute.KeyValue) []attribute.KeyValue {
+	var filtered []attribute.KeyValue
+	for _, w := range wanted {
+		for _, a := range attributes {
+			if a.Key == w.Key {
+				filtered = append(filtered, a)
+			}
+		}
+	}
+	return filtered
+}
+
+func TestBackend_Tracing(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	var traceparent string
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			traceparent = req.Header.Get("traceparent")
+			return httpmock.NewStringResponse(200, canonicalAccessToken), nil
+		})
+
+	withInMemoryTracing, exporter := inMemoryTracing()
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	}, withInMemoryTracing)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":    "test-username",
+			"scope":       "applied-permissions/user",
+			"default_ttl": 5 * time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	exporter.Reset()
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+
+	spans := exporter.GetSpans()
+
+	request := findSpan(t, spans, "read token", attribute.String("vault.path", "token/test-role"))
+	assert.Equal(t, trace.SpanKindServer, request.SpanKind)
+	assert.False(t, request.Parent.IsValid())
+
+	// Storage operations and Artifactory requests are spans of the Vault request
+	storage := findSpan(t, spans, "storage get", attribute.String("vault.storage.key", "roles/test-role"))
+	assert.Equal(t, request.SpanContext.SpanID(), storage.Parent.SpanID())
+
+	createToken := findSpan(t, spans, "POST /access/api/v1/tokens")
+	assert.Equal(t, trace.SpanKindClient, createToken.SpanKind)
+	assert.Equal(t, request.SpanContext.TraceID(), createToken.SpanContext.TraceID())
+	assert.Equal(t, request.SpanContext.SpanID(), createToken.Parent.SpanID())
+
+	// The trace is propagated to Artifactory, with the span of the Artifactory request as parent
+	assert.Equal(t, "00-"+createToken.SpanContext.TraceID().String()+"-"+createToken.SpanContext.SpanID().String()+"-01", traceparent)
+}
+
+// Failed requests are recorded on their span
+func TestBackend_TracingError(t *testing.T) {
+	withInMemoryTracing, exporter := inMemoryTracing()
+	b, config := makeBackend(t, withInMemoryTracing)
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+
+	request := findSpan(t, exporter.GetSpans(), "read token")
+	assert.Equal(t, "Error", request.Status.Code.String())
+	assert.Equal(t, "no such role", request.Status.Description)
+}
@@ -2,12 +2,14 @@ package artifactory
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/jarcoal/httpmock"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,7 +45,7 @@ func TestBackend_NoRoleMaxTTLUsesSystemMaxTTL(t *testing.T) {
 	roleData := map[string]interface{}{
 		"role":     "test-role",
 		"username": "test-username",
-		"scope":    "test-scope",
+		"scope":    "applied-permissions/groups:test-group",
 	}
 
 	resp, err := b.HandleRequest(context.Background(), &logical.Request{
@@ -90,7 +92,7 @@ func TestBackend_WorkingWithBothMaxTTLs(t *testing.T) {
 	roleData := map[string]interface{}{
 		"role":     "test-role",
 		"username": "test-username",
-		"scope":    "test-scope",
+		"scope":    "applied-permissions/groups:test-group",
 		"max_ttl":  9 * time.Minute,
 	}
 
@@ -370,3 +372,149 @@ func TestBackend_UserTokenDefaultTTL(t *testing.T) {
 
 	assert.EqualValues(t, 42*time.Minute, resp.Secret.TTL)
 }
+
+// With expiry_policy 'ttl_plus_grace', the access token must expire at the end of the lease ttl plus the grace period,
+// and the lease must not outlive it.
+func TestBackend_ExpiryPolicyTTLPlusGrace(t *testing.T) {
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	var tokenRequest access.CreateTokenRequest
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&tokenRequest))
+			return httpmock.NewStringResponse(200, jwtAccessToken), nil
+		})
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":      "test-username",
+			"scope":         "applied-permissions/groups:test-group",
+			"default_ttl":   5 * 60,
+			"max_ttl":       60 * 60,
+			"expiry_policy": "ttl_plus_grace",
+			"expiry_grace":  60,
+		},
+	})
+	assert.Nil(t, resp)
+	assert.NoError(t, err)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, 6*60, tokenRequest.ExpiresIn)
+	assert.True(t, tokenRequest.ForceRevocable)
+	assert.EqualValues(t, 6*60, resp.Data["expires_in"])
+	assert.Equal(t, 5*time.Minute, resp.Secret.TTL)
+	assert.Equal(t, 6*time.Minute, resp.Secret.MaxTTL)
+
+	// A ttl on the request moves the expiry along
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"ttl": 10 * 60,
+		},
+	})
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 11*60, tokenRequest.ExpiresIn)
+}
+
+// With expiry_policy 'never', the access token must not expire even if use_expiring_tokens is set
+func TestBackend_ExpiryPolicyNever(t *testing.T) {
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	var tokenRequest access.CreateTokenRequest
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&tokenRequest))
+			return httpmock.NewStringResponse(200, jwtAccessToken), nil
+		})
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token":        "test-access-token",
+		"url":                 "http://myserver.com:80",
+		"use_expiring_tokens": true,
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":      "test-username",
+			"scope":         "applied-permissions/groups:test-group",
+			"max_ttl":       60 * 60,
+			"expiry_policy": "never",
+		},
+	})
+	assert.Nil(t, resp)
+	assert.NoError(t, err)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, 0, tokenRequest.ExpiresIn)
+	assert.False(t, tokenRequest.ForceRevocable)
+	assert.EqualValues(t, 0, resp.Data["expires_in"])
+	assert.Equal(t, time.Hour, resp.Secret.MaxTTL)
+}
+
+// Expiring tokens require Artifactory 7.50.3 or later
+func TestBackend_ExpiryPolicyRequiresForceRevocable(t *testing.T) {
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.45.0", "revision" : "74500900"}`)
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":      "test-username",
+			"scope":         "applied-permissions/groups:test-group",
+			"expiry_policy": "max_ttl",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `expiry_policy "max_ttl" requires Artifactory 7.50.3 or later`)
+}
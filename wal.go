@@ -0,0 +1,223 @@
+package artifactory
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/template"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jfrog/vault-plugin-secrets-artifactory/access"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	walTypeAccessToken      = "access_token"
+	walTypeUser             = "user"
+	walTypePermissionTarget = "permission_target"
+)
+
+// walAccessToken records an access token created in Artifactory which has not yet been
+// committed to Vault (as a lease or static credential). Uncommitted entries are rolled back
+// by revoking the access token.
+type walAccessToken struct {
+	Connection string `json:"connection" mapstructure:"connection"`
+	TokenID    string `json:"token_id" mapstructure:"token_id"`
+	// AccessToken is only recorded for Artifactory versions before 7.21.1, which can only revoke an access
+	// token given the token itself. WAL entries aren't seal wrapped, so later versions revoke by TokenID.
+	AccessToken string `json:"access_token,omitempty" mapstructure:"access_token"`
+}
+
+// walUser records an Artifactory user created for a lease which has not yet been committed to Vault.
+// Uncommitted entries are rolled back by deleting the user.
+type walUser struct {
+	Connection string `json:"connection" mapstructure:"connection"`
+	Username   string `json:"username" mapstructure:"username"`
+}
+
+// createUserWithWAL creates the Artifactory user of the role and records it in a WAL entry, as for
+// createTokenWithWAL. The WAL entry is written first, so the user is deleted if any later step fails,
+// or if the outcome of its creation is unknown. When Artifactory rejects the creation, such as for a user
+// which already exists, the WAL entry is deleted, so that the rollback doesn't delete a user it didn't create.
+func (b *backend) createUserWithWAL(ctx context.Context, storage logical.Storage, config adminConfiguration, role artifactoryRole) (string, error) {
+	walID, err := framework.PutWAL(ctx, storage, walTypeUser, &walUser{
+		Connection: config.name,
+		Username:   role.Username,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error writing WAL entry: %w", err)
+	}
+
+	if err := b.createUser(ctx, config, role.Username, role.Groups); err != nil {
+		if statusCode := access.StatusCode(err); statusCode >= http.StatusBadRequest && statusCode < http.StatusInternalServerError {
+			if walErr := framework.DeleteWAL(ctx, storage, walID); walErr != nil {
+				b.Logger().Error("error deleting WAL entry of rejected user", "username", role.Username, "err", walErr)
+			}
+		}
+		return "", err
+	}
+
+	if len(role.ProjectKey) > 0 {
+		if err := b.addProjectMember(ctx, config, role.ProjectKey, role.Username, role.ProjectRoles); err != nil {
+			return "", err
+		}
+	}
+
+	return walID, nil
+}
+
+// walPermissionTarget records a permission target created for a lease which has not yet been committed
+// to Vault. Uncommitted entries are rolled back by deleting the permission target.
+type walPermissionTarget struct {
+	Connection string `json:"connection" mapstructure:"connection"`
+	Name       string `json:"name" mapstructure:"name"`
+}
+
+// createPermissionTargetWithWAL creates a uniquely named permission target from the permission_target template
+// of the role, and records it in a WAL entry as for createUserWithWAL. It returns the name of the permission target.
+func (b *backend) createPermissionTargetWithWAL(ctx context.Context, storage logical.Storage, config adminConfiguration, role artifactoryRole, metadata PermissionTargetMetadata) (string, string, error) {
+	target, err := renderPermissionTarget(role.PermissionTarget, metadata)
+	if err != nil {
+		return "", "", err
+	}
+
+	nameProducer, err := template.NewTemplate(template.Template(permissionTargetNameTemplate))
+	if err != nil {
+		return "", "", err
+	}
+
+	name, err := nameProducer.Generate(metadata)
+	if err != nil {
+		return "", "", err
+	}
+
+	walID, err := framework.PutWAL(ctx, storage, walTypePermissionTarget, &walPermissionTarget{
+		Connection: config.name,
+		Name:       name,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error writing WAL entry: %w", err)
+	}
+
+	if err := b.createPermissionTarget(ctx, config, name, metadata.Username, *target); err != nil {
+		return "", "", err
+	}
+
+	return name, walID, nil
+}
+
+// createTokenWithWAL creates an access token and records it in a WAL entry. The caller must
+// delete the WAL entry once the access token is committed; otherwise the token is revoked
+// by the WAL rollback.
+func (b *backend) createTokenWithWAL(ctx context.Context, storage logical.Storage, config adminConfiguration, role artifactoryRole) (*access.CreateTokenResponse, string, error) {
+	resp, err := b.CreateToken(ctx, config, role)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entry := &walAccessToken{
+		Connection: config.name,
+		TokenID:    resp.TokenID,
+	}
+	if !b.useNewAccessAPI(ctx, config) {
+		entry.AccessToken = resp.AccessToken
+	}
+
+	walID, err := framework.PutWAL(ctx, storage, walTypeAccessToken, entry)
+	if err != nil {
+		// Without a WAL entry nothing would clean up the access token, so revoke it right away
+		if revokeErr := b.revokeAccessToken(ctx, config, resp.AccessToken, resp.TokenID); revokeErr != nil {
+			b.Logger().Error("error revoking access token after failing to write WAL entry", "tokenId", resp.TokenID, "err", revokeErr)
+		}
+		return nil, "", fmt.Errorf("error writing WAL entry: %w", err)
+	}
+
+	return resp, walID, nil
+}
+
+func (b *backend) walRollback(ctx context.Context, req *logical.Request, kind string, data interface{}) error {
+	switch kind {
+	case walTypeAccessToken:
+		return b.accessTokenRollback(ctx, req, data)
+	case walTypeUser:
+		return b.userRollback(ctx, req, data)
+	case walTypePermissionTarget:
+		return b.permissionTargetRollback(ctx, req, data)
+	default:
+		return fmt.Errorf("unknown WAL entry type %q", kind)
+	}
+}
+
+func (b *backend) accessTokenRollback(ctx context.Context, req *logical.Request, data interface{}) error {
+	var entry walAccessToken
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, entry.Connection)
+	if err != nil {
+		return err
+	}
+
+	if config == nil {
+		// The connection is gone, so there is nothing left to revoke the access token with
+		b.Logger().Warn("dropping WAL entry for access token of unconfigured connection", "connection", entry.Connection, "tokenId", entry.TokenID)
+		return nil
+	}
+
+	b.Logger().Info("rolling back uncommitted access token", "connection", entry.Connection, "tokenId", entry.TokenID)
+
+	return b.revokeAccessToken(ctx, *config, entry.AccessToken, entry.TokenID)
+}
+
+func (b *backend) userRollback(ctx context.Context, req *logical.Request, data interface{}) error {
+	var entry walUser
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, entry.Connection)
+	if err != nil {
+		return err
+	}
+
+	if config == nil {
+		b.Logger().Warn("dropping WAL entry for user of unconfigured connection", "connection", entry.Connection, "username", entry.Username)
+		return nil
+	}
+
+	b.Logger().Info("rolling back uncommitted user", "connection", entry.Connection, "username", entry.Username)
+
+	return b.deleteUser(ctx, *config, entry.Username)
+}
+
+func (b *backend) permissionTargetRollback(ctx context.Context, req *logical.Request, data interface{}) error {
+	var entry walPermissionTarget
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	config, err := b.fetchConnectionConfiguration(ctx, req.Storage, entry.Connection)
+	if err != nil {
+		return err
+	}
+
+	if config == nil {
+		b.Logger().Warn("dropping WAL entry for permission target of unconfigured connection", "connection", entry.Connection, "name", entry.Name)
+		return nil
+	}
+
+	b.Logger().Info("rolling back uncommitted permission target", "connection", entry.Connection, "name", entry.Name)
+
+	return b.deletePermissionTarget(ctx, *config, entry.Name)
+}
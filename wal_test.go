@@ -0,0 +1,235 @@
+package artifactory
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackend_TokenCreateDeletesWAL(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":    "test-username",
+			"scope":       "applied-permissions/groups:test-group",
+			"default_ttl": 5 * time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   config.StorageView,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+
+	walIDs, err := framework.ListWAL(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+	assert.Empty(t, walIDs)
+}
+
+// The access token itself isn't written to the WAL entry when it can be revoked by its ID
+func TestBackend_TokenWALOmitsAccessToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	adminConfig, err := b.fetchAdminConfiguration(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+
+	resp, walID, err := b.createTokenWithWAL(context.Background(), config.StorageView, *adminConfig, artifactoryRole{
+		GrantType: "client_credentials",
+		Username:  "test-username",
+		Scope:     "applied-permissions/user",
+	})
+	assert.NoError(t, err)
+
+	entry, err := framework.GetWAL(context.Background(), config.StorageView, walID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"connection": "",
+		"token_id":   resp.TokenID,
+	}, entry.Data)
+}
+
+func TestBackend_WALRollbackRevokesToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/orphaned-token-id",
+		httpmock.NewStringResponder(200, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	_, err := framework.PutWAL(context.Background(), config.StorageView, walTypeAccessToken, &walAccessToken{
+		TokenID: "orphaned-token-id",
+	})
+	assert.NoError(t, err)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RollbackOperation,
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"immediate": true,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE http://myserver.com:80/access/api/v1/tokens/orphaned-token-id"])
+
+	walIDs, err := framework.ListWAL(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+	assert.Empty(t, walIDs)
+}
+
+// A failed revocation keeps the WAL entry, so the rollback is retried
+func TestBackend_WALRollbackRetriesFailedRevoke(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodDelete,
+		"http://myserver.com:80/access/api/v1/tokens/orphaned-token-id",
+		httpmock.NewStringResponder(503, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	_, err := framework.PutWAL(context.Background(), config.StorageView, walTypeAccessToken, &walAccessToken{
+		TokenID: "orphaned-token-id",
+	})
+	assert.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RollbackOperation,
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"immediate": true,
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "could not revoke tokenID: orphaned-token-id")
+
+	walIDs, err := framework.ListWAL(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+	assert.Len(t, walIDs, 1)
+}
+
+// failingWALDeleteStorage fails to delete the first WAL entry
+type failingWALDeleteStorage struct {
+	logical.Storage
+	failed bool
+}
+
+func (s *failingWALDeleteStorage) Delete(ctx context.Context, key string) error {
+	if !s.failed && strings.HasPrefix(key, "wal/") {
+		s.failed = true
+		return errors.New("storage unavailable")
+	}
+	return s.Storage.Delete(ctx, key)
+}
+
+// A WAL entry which can't be deleted doesn't keep the others of the lease from being deleted
+func TestBackend_TokenCreateDeletesRemainingWAL(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mockArtifactoryUsageVersionRequests(`{"version" : "7.55.6", "revision" : "75506900"}`)
+
+	httpmock.RegisterResponder(
+		http.MethodPost,
+		"http://myserver.com:80/access/api/v1/tokens",
+		httpmock.NewStringResponder(200, jwtAccessToken))
+
+	httpmock.RegisterRegexpResponder(
+		http.MethodPost,
+		regexp.MustCompile(`^http://myserver.com:80/artifactory/api/v2/security/permissions/`),
+		httpmock.NewStringResponder(201, ""))
+
+	b, config := configuredBackend(t, map[string]interface{}{
+		"access_token": "test-access-token",
+		"url":          "http://myserver.com:80",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"username":          "test-username",
+			"scope":             "applied-permissions/user",
+			"permission_target": `{"repositories": ["generic-local"], "actions": ["read"]}`,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/test-role",
+		Storage:   &failingWALDeleteStorage{Storage: config.StorageView},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.False(t, resp.IsError())
+
+	// Only the WAL entry of the permission target, written first, is left to be rolled back
+	walIDs, err := framework.ListWAL(context.Background(), config.StorageView)
+	assert.NoError(t, err)
+	assert.Len(t, walIDs, 1)
+
+	entry, err := framework.GetWAL(context.Background(), config.StorageView, walIDs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, walTypePermissionTarget, entry.Kind)
+}